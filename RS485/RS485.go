@@ -8,30 +8,110 @@
 // Typically the RTS signal is used to provide as a mechanism to control
 // transmit / receive enable. This package helps to achieve this.
 // Note: That this package only support half duplex RS485 links only.
+//
+// The direction is switched by a Control function in software, or with
+// Config.Kernel by the RS485 mode of the driver (Linux TIOCSRS485) which
+// switches RTS right at the start and end of the transmission. Without
+// the driver support NewWithConfig falls back to the Control function.
+//
+// With Config.Echo the transmission received back by the transceivers that
+// keep the receiver enabled is read after each Write, compared with the
+// data sent and removed so that Read provides only the data of the other
+// nodes. A difference is reported as ErrCollision. The data received before
+// the Write is kept and provided first by the Reads. Read is not to be used
+// in parallel with Write in this mode.
+//
+// Transact sends a request to an addressed node and waits for its response,
+// with the response timeout, the inter-frame silence, the retries and the
+// response frame check of the Config, keeping the Stats of each address.
+//
+// Port is a serial.Port. The direction pin (RTS unless Config.Pin, none
+// with New) and the RS485 mode of the driver are reserved for the direction
+// control, the changes of them by the other users of the Port fail with
+// ErrDirectionPin.
+//
+// In software the direction is held after Write till the data has left
+// the transmitter (Port.Drain) and for at least a Character time at the
+// baud rate and frame format of the Port, or the delay after if longer.
 
 package RS485
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/boseji/serial"
+	"github.com/boseji/serial/internal/timing"
 )
 
 // Control is a type of function that can receive a boolean value and
 // apply that to a paricular serial port handshake pin (DTR / RTS).
 type Control func(bool) error
 
+// Config of the RS485 Port
+type Config struct {
+	DelayBefore time.Duration // Delay from enabling the transmitter to sending
+	DelayAfter  time.Duration // Delay from the end of sending to disabling the transmitter
+	Control     Control       // Direction control in software, used without the Kernel mode
+	Kernel      bool          // Direction control by the driver on RTS (Linux)
+	RTSLow      bool          // RTS is low while sending in the Kernel mode
+	RxDuringTx  bool          // Keep receiving while sending in the Kernel mode, implied by Echo
+	Terminate   bool          // Enable the bus termination in the Kernel mode
+	Echo        bool          // Receiver gets the transmission back, its verified and removed
+	EchoTimeout time.Duration // Wait for the Echo beyond its transmission time, defaults to 50ms
+
+	// Output line driven by the Control, reserved for the direction and
+	// guarded against the other users of the Port, defaults to RTS
+	Pin serial.ModemSignal
+
+	// Transact settings
+	ResponseTimeout time.Duration // Wait for the complete response, defaults to 100ms
+	Silence         time.Duration // Inter-frame silence, defaults to 3.5 Characters
+	Retries         int           // Repeats of a request without a valid response
+	Matcher         Matcher       // Response frame check, the frame ends with the Silence without it
+	MaxResponse     int           // Largest response frame, defaults to 256 bytes
+}
+
+// Default wait for the Echo beyond its transmission time, for the latency
+// of the USB adapters
+const defaultEchoTimeout = 50 * time.Millisecond
+
+// ErrCollision - Echo of the transmission differs from the data sent or is
+// incomplete, as another node was transmitting at the same time
+var ErrCollision = errors.New("bus collision")
+
 // Port provides a way to control the Halfduplex communication on RS485
 type Port struct {
 	port        serial.Port
 	delayBefore time.Duration
 	delayAfter  time.Duration
 	sig         Control
+	kernel      bool               // Direction controlled by the driver
+	pin         serial.ModemSignal // Output line reserved for the direction
+	rs485       serial.RS485Config // Settings accepted by the driver
+	echo        bool               // Echo is verified and removed after Write
+	echoTimeout time.Duration
+	rmx         sync.Mutex
+	pending     []byte // Received before a Write with the Echo, Read first
+
+	// Transactions
+	bus             sync.Mutex // One Transaction at a time on the bus
+	last            time.Time  // End of the last Transaction
+	responseTimeout time.Duration
+	silence         time.Duration
+	retries         int
+	matcher         Matcher
+	maxResponse     int
+	smx             sync.Mutex
+	stats           map[int]*Stats
 }
 
 // New creates a new Port that is configured for the timing and signalling
-// requirements for halfduplex RS485
+// requirements for halfduplex RS485. The line driven by the Control is not
+// known so no line is guarded, NewWithConfig with Config.Pin guards it.
 func New(port serial.Port, delayBefore, delayAfter time.Duration, sig Control) (*Port, error) {
 	if port == nil || sig == nil {
 		return nil, serial.ErrPortNotInitialized
@@ -50,12 +130,120 @@ func New(port serial.Port, delayBefore, delayAfter time.Duration, sig Control) (
 	return p, nil
 }
 
+// NewWithConfig creates a new Port using the RS485 mode of the driver if
+// requested, falling back to the Control function when the driver does
+// not support it
+func NewWithConfig(port serial.Port, cfg *Config) (*Port, error) {
+	if port == nil || cfg == nil {
+		return nil, serial.ErrPortNotInitialized
+	}
+	if cfg.Pin != serial.ModemRTS && cfg.Pin != serial.ModemDTR && cfg.Pin != 0 {
+		return nil, fmt.Errorf("direction pin %v is not a single output line", cfg.Pin)
+	}
+	p, err := newPort(port, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !p.kernel {
+		p.pin = cfg.Pin
+		if p.pin == 0 {
+			p.pin = serial.ModemRTS
+		}
+	}
+
+	// Echo Cancellation
+	p.echo = cfg.Echo
+	p.echoTimeout = cfg.EchoTimeout
+	if p.echoTimeout <= 0 {
+		p.echoTimeout = defaultEchoTimeout
+	}
+
+	// Transactions
+	p.responseTimeout = cfg.ResponseTimeout
+	p.silence = cfg.Silence
+	p.retries = cfg.Retries
+	p.matcher = cfg.Matcher
+	p.maxResponse = cfg.MaxResponse
+	return p, nil
+}
+
+// newPort creates the Port for the direction control of the Config
+func newPort(port serial.Port, cfg *Config) (*Port, error) {
+	if !cfg.Kernel {
+		return New(port, cfg.DelayBefore, cfg.DelayAfter, cfg.Control)
+	}
+
+	applied, err := port.SetRS485(serial.RS485Config{
+		Enabled:         true,
+		RTSOnSend:       !cfg.RTSLow,
+		RTSAfterSend:    cfg.RTSLow,
+		DelayBeforeSend: cfg.DelayBefore,
+		DelayAfterSend:  cfg.DelayAfter,
+		RxDuringTx:      cfg.RxDuringTx || cfg.Echo, // Echo needs the receiver
+		Terminate:       cfg.Terminate,
+	})
+	if err == nil && applied.Enabled && cfg.Echo && !applied.RxDuringTx {
+		// Every Write would fail without the Echo
+		port.SetRS485(serial.RS485Config{})
+		return nil, fmt.Errorf("RS485 mode of the driver does not receive while sending for the echo - %w",
+			serial.ErrNotImplemented)
+	}
+	if err == nil && applied.Enabled {
+		return &Port{
+			port:        port,
+			delayBefore: applied.DelayBeforeSend,
+			delayAfter:  applied.DelayAfterSend,
+			kernel:      true,
+			pin:         serial.ModemRTS,
+			rs485:       applied,
+		}, nil
+	}
+
+	// Driver without the RS485 mode
+	if err != nil && !errors.Is(err, serial.ErrNotImplemented) {
+		return nil, fmt.Errorf("could not enable the RS485 mode - %w", err)
+	}
+	if cfg.Control == nil {
+		return nil, fmt.Errorf("RS485 mode not supported by the driver - %w", serial.ErrNotImplemented)
+	}
+	return New(port, cfg.DelayBefore, cfg.DelayAfter, cfg.Control)
+}
+
+// Kernel provides the settings accepted by the driver, if the direction
+// is controlled by the driver
+func (p *Port) Kernel() (serial.RS485Config, bool) {
+	if p == nil {
+		return serial.RS485Config{}, false
+	}
+	return p.rs485, p.kernel
+}
+
 // Write implemantion of io.Writer interface
 func (p *Port) Write(b []byte) (n int, err error) {
 	if p == nil || len(b) == 0 {
 		return 0, fmt.Errorf("failed to write empty / un-initialized port")
 	}
 
+	if p.echo {
+		if err = p.stash(context.Background()); err != nil {
+			return 0, err
+		}
+	}
+	n, err = p.transmit(context.Background(), b, p.port.Write)
+	if err == nil && p.echo {
+		err = p.readEcho(context.Background(), b[:n])
+	}
+	return n, err
+}
+
+// transmit sends the data with the direction control using the write
+// function of the Port, the Context limits the turnaround
+func (p *Port) transmit(ctx context.Context, b []byte, write func(b []byte) (int, error)) (n int, err error) {
+	// Driver controls the direction
+	if p.kernel {
+		return write(b)
+	}
+
 	// Startup
 	err = p.sig(true) // Activate the Signal
 	if err != nil {
@@ -66,24 +254,138 @@ func (p *Port) Write(b []byte) (n int, err error) {
 	}
 
 	// Transmit
-	n, err = p.port.Write(b)
+	n, err = write(b)
 
 	// End
 	defer func() {
-		if p.delayAfter != 0 {
-			time.Sleep(p.delayAfter)
+		terr := p.turnaround(ctx)
+		serr := p.sig(false) // Deactivate
+		if err == nil {
+			err = terr
+		}
+		if err == nil && serr != nil {
+			err = fmt.Errorf("failed to lower the signal after RS485 Write - %w", serr)
 		}
-		err = p.sig(false) // Deactivate
 	}()
 
 	return
 }
 
+// stash keeps the data received before a Write for the Reads, so that it's
+// not taken for the Echo
+func (p *Port) stash(ctx context.Context) error {
+	n, err := p.port.InWaiting()
+	if errors.Is(err, serial.ErrNotImplemented) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check the data received before RS485 Write - %w", err)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	buf := make([]byte, n)
+	got := 0
+	for got < n && err == nil {
+		var m int
+		m, err = p.port.ReadContext(ctx, buf[got:])
+		got += m
+	}
+	p.rmx.Lock()
+	p.pending = append(p.pending, buf[:got]...)
+	p.rmx.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to read the data received before RS485 Write - %w", err)
+	}
+	return nil
+}
+
+// unstash provides the data kept by stash
+func (p *Port) unstash(b []byte) int {
+	p.rmx.Lock()
+	defer p.rmx.Unlock()
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	if len(p.pending) == 0 {
+		p.pending = nil
+	}
+	return n
+}
+
+// readEcho removes the Echo of the data sent from the received data and
+// verifies it, the data received after the Echo is kept for Read
+func (p *Port) readEcho(ctx context.Context, sent []byte) error {
+	timeout := p.echoTimeout
+	if cfg, err := p.port.Config(); err == nil {
+		timeout += cfg.CharTime() * time.Duration(len(sent))
+	}
+	ectx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	echo := make([]byte, len(sent))
+	got := 0
+	for got < len(echo) {
+		n, err := p.port.ReadContext(ectx, echo[got:])
+		for i := got; i < got+n; i++ {
+			if echo[i] != sent[i] {
+				// Rest of the Echo is garbled too
+				p.port.Flush(true, false)
+				return fmt.Errorf("%w - echo byte %d is 0x%02X instead of 0x%02X",
+					ErrCollision, i, echo[i], sent[i])
+			}
+		}
+		got += n
+		if cerr := ctx.Err(); cerr != nil && err != nil {
+			return cerr
+		}
+		if err == context.DeadlineExceeded {
+			// Bytes garbled by the Collision are dropped by the driver
+			return fmt.Errorf("%w - echo has %d of %d bytes", ErrCollision, got, len(sent))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the echo of RS485 Write - %w", err)
+		}
+	}
+	return nil
+}
+
+// turnaround holds the direction till the written data has left the
+// transmitter, Write returns once the data is in the driver queue
+func (p *Port) turnaround(ctx context.Context) error {
+	err := p.port.DrainContext(ctx)
+	if errors.Is(err, serial.ErrNotImplemented) {
+		err = nil
+	}
+	if serr := timing.Sleep(ctx, p.afterDelay()); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// afterDelay provides the delay after sending, at least a Character time
+// at the baud rate and frame format of the Port. Its applied after every
+// Drain as the drivers of the USB adapters return before the last
+// Character has left the transmitter, and Drain can't tell which do.
+func (p *Port) afterDelay() time.Duration {
+	d := p.delayAfter
+	if cfg, err := p.port.Config(); err == nil {
+		if ct := cfg.CharTime(); ct > d {
+			d = ct
+		}
+	}
+	return d
+}
+
 // Close implementation of io.Closer interface
 func (p *Port) Close() error {
 	if p == nil {
 		return serial.ErrNotOpen
 	}
+	// RS485 mode stays in the driver after Close
+	if p.kernel {
+		p.port.SetRS485(serial.RS485Config{}) // Closing anyway so Errors are ignored
+	}
 	return p.port.Close()
 }
 
@@ -93,6 +395,16 @@ func (p *Port) Read(b []byte) (n int, err error) {
 		return 0, fmt.Errorf("failed to read empty / un-initialized port")
 	}
 
+	// Data received before the last Write
+	if n = p.unstash(b); n > 0 {
+		return n, nil
+	}
+
+	// Driver controls the direction
+	if p.kernel {
+		return p.port.Read(b)
+	}
+
 	// Startup
 	err = p.sig(false) // Activate the Signal
 	if err != nil {
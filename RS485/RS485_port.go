@@ -0,0 +1,401 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+package RS485
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boseji/serial"
+	"github.com/boseji/serial/internal/timing"
+)
+
+// Port is a serial.Port, the Reads and the Writes have the direction
+// control and the rest is provided by the underlying Port
+var _ serial.Port = (*Port)(nil)
+
+// ErrDirectionPin - Output line or the RS485 mode is in use for the
+// direction control and can't be changed by the other users of the Port
+var ErrDirectionPin = errors.New("reserved for the direction control")
+
+// reserved checks that the lines don't include the direction pin
+func (p *Port) reserved(lines serial.ModemSignal) error {
+	if lines&p.pin != 0 {
+		return fmt.Errorf("%w - line %v", ErrDirectionPin, p.pin)
+	}
+	return nil
+}
+
+// polarity checks that the Signal Inversion stays as it is, as it would
+// invert the direction pin
+func (p *Port) polarity(en bool) error {
+	if p.pin == 0 {
+		return nil
+	}
+	cfg, err := p.port.Config()
+	if err != nil {
+		return err
+	}
+	if cfg.SignalInvert == en {
+		return nil
+	}
+	return fmt.Errorf("%w - inversion of line %v", ErrDirectionPin, p.pin)
+}
+
+// release frees the bus in software before a Read
+func (p *Port) release() error {
+	if p.kernel {
+		return nil
+	}
+	if err := p.sig(false); err != nil {
+		return fmt.Errorf("failed to lower the signal for RS485 Read - %w", err)
+	}
+	return nil
+}
+
+// ReadContext reads with the direction control till the Context is done
+func (p *Port) ReadContext(ctx context.Context, b []byte) (n int, err error) {
+	if p == nil || len(b) == 0 {
+		return 0, fmt.Errorf("failed to read empty / un-initialized port")
+	}
+	if n = p.unstash(b); n > 0 {
+		return n, nil
+	}
+	if err = p.release(); err != nil {
+		return 0, err
+	}
+	return p.port.ReadContext(ctx, b)
+}
+
+// WriteContext writes with the direction control till the Context is done
+func (p *Port) WriteContext(ctx context.Context, b []byte) (n int, err error) {
+	if p == nil || len(b) == 0 {
+		return 0, fmt.Errorf("failed to write empty / un-initialized port")
+	}
+
+	if p.echo {
+		if err = p.stash(ctx); err != nil {
+			return 0, err
+		}
+	}
+	n, err = p.transmit(ctx, b, func(b []byte) (int, error) {
+		return p.port.WriteContext(ctx, b)
+	})
+	if err == nil && p.echo {
+		err = p.readEcho(ctx, b[:n])
+	}
+	return n, err
+}
+
+// ReadFrame reads a frame ended by the gap with the direction control
+func (p *Port) ReadFrame(b []byte, gap time.Duration) (n int, err error) {
+	if p == nil || len(b) == 0 {
+		return 0, fmt.Errorf("failed to read empty / un-initialized port")
+	}
+	if n = p.unstash(b); n > 0 {
+		return n, nil
+	}
+	if err = p.release(); err != nil {
+		return 0, err
+	}
+	return p.port.ReadFrame(b, gap)
+}
+
+// ReadMarked reads with the line Errors with the direction control
+func (p *Port) ReadMarked(ctx context.Context, b []byte, errs []serial.LineError) (n int, err error) {
+	if p == nil || len(b) == 0 {
+		return 0, fmt.Errorf("failed to read empty / un-initialized port")
+	}
+	if len(errs) < len(b) {
+		return 0, fmt.Errorf("errors buffer shorter than the data buffer")
+	}
+	if n = p.unstash(b); n > 0 {
+		for i := range errs[:n] {
+			errs[i] = 0
+		}
+		return n, nil
+	}
+	if err = p.release(); err != nil {
+		return 0, err
+	}
+	return p.port.ReadMarked(ctx, b, errs)
+}
+
+func (p *Port) SetDeadline(t time.Time) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	return p.port.SetDeadline(t)
+}
+
+func (p *Port) SetReadDeadline(t time.Time) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	return p.port.SetReadDeadline(t)
+}
+
+func (p *Port) SetWriteDeadline(t time.Time) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	return p.port.SetWriteDeadline(t)
+}
+
+// Rts is rejected when RTS is the direction pin
+func (p *Port) Rts(en bool) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	if err := p.reserved(serial.ModemRTS); err != nil {
+		return err
+	}
+	return p.port.Rts(en)
+}
+
+// Dtr is rejected when DTR is the direction pin
+func (p *Port) Dtr(en bool) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	if err := p.reserved(serial.ModemDTR); err != nil {
+		return err
+	}
+	return p.port.Dtr(en)
+}
+
+// SetSignals is rejected for the direction pin
+func (p *Port) SetSignals(set, clear serial.ModemSignal) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	if err := p.reserved(set | clear); err != nil {
+		return err
+	}
+	return p.port.SetSignals(set, clear)
+}
+
+// PulseSignals is rejected if any of the Steps has the direction pin
+func (p *Port) PulseSignals(ctx context.Context, steps []serial.SignalStep) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	for _, st := range steps {
+		if err := p.reserved(st.Set | st.Clear); err != nil {
+			return err
+		}
+	}
+	return p.port.PulseSignals(ctx, steps)
+}
+
+// SetRS485 is rejected as the Port manages the RS485 mode of the driver
+func (p *Port) SetRS485(cfg serial.RS485Config) (serial.RS485Config, error) {
+	if p == nil {
+		return serial.RS485Config{}, serial.ErrNotOpen
+	}
+	return serial.RS485Config{}, fmt.Errorf("%w - RS485 mode of the driver", ErrDirectionPin)
+}
+
+func (p *Port) RS485() (serial.RS485Config, error) {
+	if p == nil {
+		return serial.RS485Config{}, serial.ErrNotOpen
+	}
+	return p.port.RS485()
+}
+
+// SendBreak enables the transmitter in software for the Break
+func (p *Port) SendBreak(en bool) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	if p.kernel {
+		return p.port.SendBreak(en)
+	}
+	if !en {
+		err := p.port.SendBreak(false)
+		if serr := p.sig(false); err == nil && serr != nil {
+			err = fmt.Errorf("failed to lower the signal after RS485 Break - %w", serr)
+		}
+		return err
+	}
+	if err := p.sig(true); err != nil {
+		return fmt.Errorf("failed to raise the signal for RS485 Break - %w", err)
+	}
+	if p.delayBefore != 0 {
+		time.Sleep(p.delayBefore)
+	}
+	return p.port.SendBreak(true)
+}
+
+// SendBreakFor enables the transmitter in software for the Break
+func (p *Port) SendBreakFor(d time.Duration) (err error) {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	if p.kernel {
+		return p.port.SendBreakFor(d)
+	}
+	if err = p.sig(true); err != nil {
+		return fmt.Errorf("failed to raise the signal for RS485 Break - %w", err)
+	}
+	if p.delayBefore != 0 {
+		time.Sleep(p.delayBefore)
+	}
+	err = p.port.SendBreakFor(d)
+	timing.Sleep(context.Background(), p.afterDelay())
+	if serr := p.sig(false); err == nil && serr != nil {
+		err = fmt.Errorf("failed to lower the signal after RS485 Break - %w", serr)
+	}
+	return err
+}
+
+func (p *Port) Cts() (bool, error) {
+	if p == nil {
+		return false, serial.ErrNotOpen
+	}
+	return p.port.Cts()
+}
+
+func (p *Port) Dsr() (bool, error) {
+	if p == nil {
+		return false, serial.ErrNotOpen
+	}
+	return p.port.Dsr()
+}
+
+func (p *Port) Ring() (bool, error) {
+	if p == nil {
+		return false, serial.ErrNotOpen
+	}
+	return p.port.Ring()
+}
+
+func (p *Port) Dcd() (bool, error) {
+	if p == nil {
+		return false, serial.ErrNotOpen
+	}
+	return p.port.Dcd()
+}
+
+func (p *Port) SetBaud(baud int) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	return p.port.SetBaud(baud)
+}
+
+func (p *Port) Baud() (int, error) {
+	if p == nil {
+		return 0, serial.ErrNotOpen
+	}
+	return p.port.Baud()
+}
+
+func (p *Port) SetDataBits(bits byte) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	return p.port.SetDataBits(bits)
+}
+
+// Reconfigure is rejected if it changes the Signal Inversion, or hands RTS
+// to the hardware flow control while it is the direction pin
+func (p *Port) Reconfigure(cfg serial.Config) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	if cfg.Flow == serial.FlowHardware {
+		if err := p.reserved(serial.ModemRTS); err != nil {
+			return fmt.Errorf("%w for the hardware flow control", err)
+		}
+	}
+	if err := p.polarity(cfg.SignalInvert); err != nil {
+		return err
+	}
+	return p.port.Reconfigure(cfg)
+}
+
+func (p *Port) Config() (serial.Config, error) {
+	if p == nil {
+		return serial.Config{}, serial.ErrNotOpen
+	}
+	return p.port.Config()
+}
+
+// Flush of the input also drops the data received before the last Write
+func (p *Port) Flush(in, out bool) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	if in {
+		p.rmx.Lock()
+		p.pending = nil
+		p.rmx.Unlock()
+	}
+	return p.port.Flush(in, out)
+}
+
+func (p *Port) Drain() error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	return p.port.Drain()
+}
+
+func (p *Port) DrainContext(ctx context.Context) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	return p.port.DrainContext(ctx)
+}
+
+func (p *Port) InWaiting() (int, error) {
+	if p == nil {
+		return 0, serial.ErrNotOpen
+	}
+	return p.port.InWaiting()
+}
+
+func (p *Port) OutWaiting() (int, error) {
+	if p == nil {
+		return 0, serial.ErrNotOpen
+	}
+	return p.port.OutWaiting()
+}
+
+func (p *Port) Counters() (serial.Counters, error) {
+	if p == nil {
+		return serial.Counters{}, serial.ErrNotOpen
+	}
+	return p.port.Counters()
+}
+
+func (p *Port) WaitModemChange(ctx context.Context, mask serial.ModemSignal) (serial.ModemSignal, error) {
+	if p == nil {
+		return 0, serial.ErrNotOpen
+	}
+	return p.port.WaitModemChange(ctx, mask)
+}
+
+func (p *Port) ModemEvents(ctx context.Context, mask serial.ModemSignal) (<-chan serial.ModemEvent, error) {
+	if p == nil {
+		return nil, serial.ErrNotOpen
+	}
+	return p.port.ModemEvents(ctx, mask)
+}
+
+// SignalInvert is rejected if it changes the inversion of the direction pin
+func (p *Port) SignalInvert(en bool) error {
+	if p == nil {
+		return serial.ErrNotOpen
+	}
+	if err := p.polarity(en); err != nil {
+		return err
+	}
+	return p.port.SignalInvert(en)
+}
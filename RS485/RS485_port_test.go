@@ -0,0 +1,219 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+package RS485
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/boseji/serial"
+	"github.com/stretchr/testify/assert"
+)
+
+// Port with the output lines recorded
+type linesPort struct {
+	mockPort
+	set    serial.ModemSignal
+	clear  serial.ModemSignal
+	pulses int
+	breaks []time.Duration
+}
+
+func (l *linesPort) Reconfigure(cfg serial.Config) error {
+	l.cfg = cfg
+	return nil
+}
+
+func (l *linesPort) SignalInvert(en bool) error {
+	l.cfg.SignalInvert = en
+	return nil
+}
+
+func (l *linesPort) Rts(en bool) error {
+	if en {
+		return l.SetSignals(serial.ModemRTS, 0)
+	}
+	return l.SetSignals(0, serial.ModemRTS)
+}
+
+func (l *linesPort) Dtr(en bool) error {
+	if en {
+		return l.SetSignals(serial.ModemDTR, 0)
+	}
+	return l.SetSignals(0, serial.ModemDTR)
+}
+
+func (l *linesPort) SetSignals(set, clear serial.ModemSignal) error {
+	l.set |= set
+	l.clear |= clear
+	return nil
+}
+
+func (l *linesPort) PulseSignals(ctx context.Context, steps []serial.SignalStep) error {
+	l.pulses++
+	return nil
+}
+
+func (l *linesPort) SendBreakFor(d time.Duration) error {
+	l.breaks = append(l.breaks, d)
+	return nil
+}
+
+func TestPort_DirectionPin(t *testing.T) {
+	t.Run("RTS", func(t *testing.T) {
+		l := &linesPort{}
+		var c controlLog
+		p, err := NewWithConfig(l, &Config{Control: c.control})
+		assert.NoError(t, err)
+
+		// Direction pin can't be changed
+		err = p.Rts(true)
+		assert.True(t, errors.Is(err, ErrDirectionPin))
+		err = p.SetSignals(serial.ModemDTR, serial.ModemRTS)
+		assert.True(t, errors.Is(err, ErrDirectionPin))
+		err = p.PulseSignals(context.Background(), serial.ResetArduino)
+		assert.True(t, errors.Is(err, ErrDirectionPin))
+		assert.Equal(t, serial.ModemSignal(0), l.set|l.clear)
+		assert.Equal(t, 0, l.pulses)
+
+		// Other line is free
+		assert.NoError(t, p.Dtr(true))
+		assert.NoError(t, p.SetSignals(0, serial.ModemDTR))
+		assert.NoError(t, p.PulseSignals(context.Background(), []serial.SignalStep{
+			{Set: serial.ModemDTR, Hold: time.Millisecond},
+		}))
+		assert.Equal(t, serial.ModemDTR, l.set)
+		assert.Equal(t, serial.ModemDTR, l.clear)
+		assert.Equal(t, 1, l.pulses)
+	})
+
+	t.Run("DTR", func(t *testing.T) {
+		l := &linesPort{}
+		var c controlLog
+		p, err := NewWithConfig(l, &Config{Control: c.control, Pin: serial.ModemDTR})
+		assert.NoError(t, err)
+		assert.True(t, errors.Is(p.Dtr(false), ErrDirectionPin))
+		assert.NoError(t, p.Rts(true))
+		assert.Equal(t, serial.ModemRTS, l.set)
+
+		_, err = NewWithConfig(l, &Config{Control: c.control, Pin: serial.ModemOutputs})
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		// Control of New may drive any line, none is guarded
+		l := &linesPort{}
+		p, err := New(l, 0, 0, l.Dtr)
+		assert.NoError(t, err)
+		assert.NoError(t, p.Rts(true))
+		assert.NoError(t, p.Dtr(true))
+		assert.Equal(t, serial.ModemRTS|serial.ModemDTR, l.set)
+		assert.NoError(t, p.SignalInvert(true))
+	})
+
+	t.Run("Kernel", func(t *testing.T) {
+		l := &linesPort{}
+		p, err := NewWithConfig(l, &Config{Kernel: true, Pin: serial.ModemDTR})
+		assert.NoError(t, err)
+
+		// Driver always uses RTS
+		assert.True(t, errors.Is(p.Rts(true), ErrDirectionPin))
+		assert.NoError(t, p.Dtr(true))
+		_, err = p.SetRS485(serial.RS485Config{})
+		assert.True(t, errors.Is(err, ErrDirectionPin))
+		assert.True(t, l.rs485.Enabled)
+	})
+}
+
+func TestPort_Serial(t *testing.T) {
+	l := &linesPort{mockPort: mockPort{cfg: serial.Config{Baud: 115200}}}
+	var c controlLog
+	var sp serial.Port
+	p, err := NewWithConfig(l, &Config{Control: c.control})
+	assert.NoError(t, err)
+	sp = p
+
+	// Break is sent with the transmitter enabled
+	c = nil
+	assert.NoError(t, sp.SendBreakFor(5*time.Millisecond))
+	assert.Equal(t, []time.Duration{5 * time.Millisecond}, l.breaks)
+	assert.Equal(t, controlLog{true, false}, c)
+
+	// Reads release the bus
+	c = nil
+	l.in = []byte("DATA")
+	buf := make([]byte, 10)
+	n, err := sp.ReadContext(context.Background(), buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "DATA", string(buf[:n]))
+	assert.Equal(t, controlLog{false}, c)
+
+	// Rest is provided by the underlying Port
+	cfg, err := sp.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, 115200, cfg.Baud)
+
+	// Un-initialized Port
+	var np *Port
+	assert.Equal(t, serial.ErrNotOpen, np.SetBaud(9600))
+	_, err = np.ReadContext(context.Background(), buf)
+	assert.Error(t, err)
+}
+
+func TestPort_GuardedConfig(t *testing.T) {
+	t.Run("Software", func(t *testing.T) {
+		l := &linesPort{mockPort: mockPort{cfg: serial.Config{Baud: 9600}}}
+		var c controlLog
+		p, err := NewWithConfig(l, &Config{Control: c.control})
+		assert.NoError(t, err)
+
+		// Polarity of the direction pin stays
+		assert.True(t, errors.Is(p.SignalInvert(true), ErrDirectionPin))
+		assert.NoError(t, p.SignalInvert(false))
+		err = p.Reconfigure(serial.Config{Baud: 19200, SignalInvert: true})
+		assert.True(t, errors.Is(err, ErrDirectionPin))
+
+		// RTS is not given to the hardware flow control
+		err = p.Reconfigure(serial.Config{Baud: 19200, Flow: serial.FlowHardware})
+		assert.True(t, errors.Is(err, ErrDirectionPin))
+		assert.Equal(t, 9600, l.cfg.Baud)
+
+		assert.NoError(t, p.Reconfigure(serial.Config{Baud: 19200}))
+		assert.Equal(t, 19200, l.cfg.Baud)
+	})
+
+	t.Run("Config Error", func(t *testing.T) {
+		// Error of the Port is not taken for a change of the inversion
+		l := &linesPort{}
+		var c controlLog
+		p, err := NewWithConfig(l, &Config{Control: c.control})
+		assert.NoError(t, err)
+		err = p.SignalInvert(false)
+		assert.True(t, errors.Is(err, serial.ErrNotImplemented))
+		assert.False(t, errors.Is(err, ErrDirectionPin))
+	})
+
+	t.Run("DTR", func(t *testing.T) {
+		l := &linesPort{mockPort: mockPort{cfg: serial.Config{Baud: 9600}}}
+		var c controlLog
+		p, err := NewWithConfig(l, &Config{Control: c.control, Pin: serial.ModemDTR})
+		assert.NoError(t, err)
+		assert.NoError(t, p.Reconfigure(serial.Config{Baud: 9600, Flow: serial.FlowHardware}))
+		assert.True(t, errors.Is(p.SignalInvert(true), ErrDirectionPin))
+	})
+
+	t.Run("Kernel", func(t *testing.T) {
+		l := &linesPort{mockPort: mockPort{cfg: serial.Config{Baud: 9600}}}
+		p, err := NewWithConfig(l, &Config{Kernel: true})
+		assert.NoError(t, err)
+		assert.True(t, errors.Is(p.SignalInvert(true), ErrDirectionPin))
+		err = p.Reconfigure(serial.Config{Baud: 9600, Flow: serial.FlowHardware})
+		assert.True(t, errors.Is(err, ErrDirectionPin))
+		assert.False(t, l.cfg.SignalInvert)
+	})
+}
@@ -6,6 +6,7 @@
 package RS485
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -355,3 +356,337 @@ func TestPort_Read(t *testing.T) {
 		assert.Equal(t, len(message), n)
 	})
 }
+
+// Port with the RS485 mode of the driver simulated
+type mockPort struct {
+	serial.Port
+	rs485        serial.RS485Config
+	rs485Err     error
+	dropMode     bool // Driver accepts but ignores the RS485 mode
+	noRxDuringTx bool // Driver turns the receiver off while sending
+	written      []byte
+	closed       bool
+	cfg          serial.Config
+	drained      int
+	drainErr     error
+
+	// Received data and the Echo of the written data
+	mx   sync.Mutex
+	in   []byte
+	echo func(b []byte) []byte
+}
+
+func (m *mockPort) ReadContext(ctx context.Context, b []byte) (int, error) {
+	for {
+		m.mx.Lock()
+		n := copy(b, m.in)
+		m.in = m.in[n:]
+		m.mx.Unlock()
+		if n > 0 {
+			return n, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (m *mockPort) Read(b []byte) (int, error) {
+	return m.ReadContext(context.Background(), b)
+}
+
+func (m *mockPort) InWaiting() (int, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return len(m.in), nil
+}
+
+func (m *mockPort) Flush(in, out bool) error {
+	if in {
+		m.mx.Lock()
+		m.in = nil
+		m.mx.Unlock()
+	}
+	return nil
+}
+
+func (m *mockPort) Drain() error {
+	m.drained++
+	return m.drainErr
+}
+
+func (m *mockPort) DrainContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Drain()
+}
+
+func (m *mockPort) Config() (serial.Config, error) {
+	if m.cfg.Baud == 0 {
+		return serial.Config{}, serial.ErrNotImplemented
+	}
+	return m.cfg, nil
+}
+
+func (m *mockPort) SetRS485(cfg serial.RS485Config) (serial.RS485Config, error) {
+	if m.rs485Err != nil {
+		return serial.RS485Config{}, m.rs485Err
+	}
+	if m.dropMode {
+		cfg.Enabled = false
+	}
+	if m.noRxDuringTx {
+		cfg.RxDuringTx = false
+	}
+	// Driver supports only 10ms delays
+	if cfg.DelayBeforeSend > 10*time.Millisecond {
+		cfg.DelayBeforeSend = 10 * time.Millisecond
+	}
+	m.rs485 = cfg
+	return cfg, nil
+}
+
+func (m *mockPort) Write(b []byte) (int, error) {
+	m.written = append(m.written, b...)
+	if m.echo != nil {
+		m.mx.Lock()
+		m.in = append(m.in, m.echo(b)...)
+		m.mx.Unlock()
+	}
+	return len(b), nil
+}
+
+func (m *mockPort) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return m.Write(b)
+}
+
+func (m *mockPort) Close() error {
+	m.closed = true
+	return nil
+}
+
+// Recorder of the Control calls
+type controlLog []bool
+
+func (c *controlLog) control(en bool) error {
+	*c = append(*c, en)
+	return nil
+}
+
+func TestNewWithConfig(t *testing.T) {
+	t.Run("Kernel", func(t *testing.T) {
+		m := &mockPort{}
+		var c controlLog
+		rs485, err := NewWithConfig(m, &Config{
+			DelayBefore: 20 * time.Millisecond,
+			DelayAfter:  time.Millisecond,
+			Control:     c.control,
+			Kernel:      true,
+			RxDuringTx:  true,
+		})
+		assert.NoError(t, err)
+
+		// Settings accepted by the driver
+		applied, kernel := rs485.Kernel()
+		assert.True(t, kernel)
+		assert.True(t, applied.Enabled && applied.RTSOnSend && !applied.RTSAfterSend)
+		assert.True(t, applied.RxDuringTx)
+		assert.Equal(t, 10*time.Millisecond, applied.DelayBeforeSend)
+
+		// Driver switches the direction
+		_, err = rs485.Write([]byte("Hari Aum"))
+		assert.NoError(t, err)
+		assert.Equal(t, "Hari Aum", string(m.written))
+		assert.Equal(t, 0, len(c))
+
+		// RS485 mode is disabled on Close
+		assert.NoError(t, rs485.Close())
+		assert.False(t, m.rs485.Enabled)
+		assert.True(t, m.closed)
+	})
+
+	t.Run("Inverted RTS", func(t *testing.T) {
+		m := &mockPort{}
+		rs485, err := NewWithConfig(m, &Config{Kernel: true, RTSLow: true})
+		assert.NoError(t, err)
+		applied, _ := rs485.Kernel()
+		assert.True(t, !applied.RTSOnSend && applied.RTSAfterSend)
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		for _, m := range []*mockPort{
+			{rs485Err: serial.ErrNotImplemented},
+			{dropMode: true},
+		} {
+			var c controlLog
+			rs485, err := NewWithConfig(m, &Config{Control: c.control, Kernel: true})
+			assert.NoError(t, err)
+			_, kernel := rs485.Kernel()
+			assert.False(t, kernel)
+
+			// Software switches the direction
+			_, err = rs485.Write([]byte("Hari Aum"))
+			assert.NoError(t, err)
+			assert.Equal(t, controlLog{false, true, false}, c)
+		}
+	})
+
+	t.Run("Echo", func(t *testing.T) {
+		// Receiver is kept on for the Echo
+		m := &mockPort{}
+		rs485, err := NewWithConfig(m, &Config{Kernel: true, Echo: true})
+		assert.NoError(t, err)
+		applied, _ := rs485.Kernel()
+		assert.True(t, applied.RxDuringTx)
+
+		// Driver that turns it off is rejected
+		m = &mockPort{noRxDuringTx: true}
+		_, err = NewWithConfig(m, &Config{Kernel: true, Echo: true})
+		assert.True(t, errors.Is(err, serial.ErrNotImplemented))
+		assert.False(t, m.rs485.Enabled)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := NewWithConfig(&mockPort{}, nil)
+		assert.Error(t, err)
+
+		// No Fallback without Control
+		_, err = NewWithConfig(&mockPort{rs485Err: serial.ErrNotImplemented}, &Config{Kernel: true})
+		assert.True(t, errors.Is(err, serial.ErrNotImplemented))
+
+		// Other Errors of the driver
+		_, err = NewWithConfig(&mockPort{rs485Err: serial.ErrNotOpen}, &Config{Kernel: true})
+		assert.True(t, errors.Is(err, serial.ErrNotOpen))
+	})
+}
+
+func TestPort_Turnaround(t *testing.T) {
+	m := &mockPort{cfg: serial.Config{Baud: 300, DataBits: serial.DataBits8}}
+	var c controlLog
+	rs485, err := New(m, 0, time.Millisecond, c.control)
+	assert.NoError(t, err)
+
+	// Direction is held for a Character after every Drain
+	start := time.Now()
+	_, err = rs485.Write([]byte("A"))
+	took := time.Since(start)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m.drained)
+	assert.Equal(t, controlLog{false, true, false}, c)
+	charTime := m.cfg.CharTime()
+	if took < charTime || took > charTime+50*time.Millisecond {
+		t.Errorf("Expected turnaround of %v but took %v", charTime, took)
+	}
+
+	// Longer delay after is kept
+	rs485.delayAfter = 50 * time.Millisecond
+	start = time.Now()
+	_, err = rs485.Write([]byte("A"))
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	// Drain Errors are reported after releasing the direction
+	m.drainErr = serial.ErrNotOpen
+	c = nil
+	_, err = rs485.Write([]byte("A"))
+	assert.True(t, errors.Is(err, serial.ErrNotOpen))
+	assert.Equal(t, controlLog{true, false}, c)
+}
+
+func TestPort_Echo(t *testing.T) {
+	m := &mockPort{cfg: serial.Config{Baud: 115200}}
+	rs485, err := NewWithConfig(m, &Config{
+		Kernel:      true,
+		Echo:        true,
+		EchoTimeout: 20 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	t.Run("Removed", func(t *testing.T) {
+		// Response follows the Echo
+		m.echo = func(b []byte) []byte {
+			return append(append([]byte{}, b...), "RSP"...)
+		}
+		n, err := rs485.Write([]byte("REQ"))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		buf := make([]byte, 10)
+		n, err = rs485.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "RSP", string(buf[:n]))
+	})
+
+	t.Run("Received before", func(t *testing.T) {
+		// Unread reply and bus traffic are not taken for the Echo
+		m.mx.Lock()
+		m.in = []byte("OLD")
+		m.mx.Unlock()
+		m.echo = func(b []byte) []byte {
+			return append(append([]byte{}, b...), "NEW"...)
+		}
+		_, err := rs485.Write([]byte("REQ"))
+		assert.NoError(t, err)
+
+		buf := make([]byte, 10)
+		n, err := rs485.ReadContext(context.Background(), buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "OLD", string(buf[:n]))
+		n, err = rs485.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "NEW", string(buf[:n]))
+
+		// Flush drops it
+		m.mx.Lock()
+		m.in = []byte("OLD")
+		m.mx.Unlock()
+		m.echo = func(b []byte) []byte { return b }
+		_, err = rs485.Write([]byte("REQ"))
+		assert.NoError(t, err)
+		assert.NoError(t, rs485.Flush(true, false))
+		m.mx.Lock()
+		m.in = []byte("NEW")
+		m.mx.Unlock()
+		n, err = rs485.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "NEW", string(buf[:n]))
+	})
+
+	t.Run("Collision", func(t *testing.T) {
+		m.echo = func(b []byte) []byte {
+			return []byte{b[0], b[1] ^ 0x10, b[2], 'X'}
+		}
+		_, err := rs485.Write([]byte("REQ"))
+		assert.True(t, errors.Is(err, ErrCollision))
+		assert.Contains(t, err.Error(), "byte 1")
+
+		// Garbled data is discarded
+		m.mx.Lock()
+		assert.Equal(t, 0, len(m.in))
+		m.mx.Unlock()
+	})
+
+	t.Run("Incomplete", func(t *testing.T) {
+		m.echo = func(b []byte) []byte {
+			return b[:1]
+		}
+		start := time.Now()
+		_, err := rs485.Write([]byte("REQ"))
+		assert.True(t, errors.Is(err, ErrCollision))
+		assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		m.echo = nil
+		p, err := NewWithConfig(m, &Config{Kernel: true})
+		assert.NoError(t, err)
+		_, err = p.Write([]byte("REQ"))
+		assert.NoError(t, err)
+	})
+}
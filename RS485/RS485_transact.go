@@ -0,0 +1,243 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+package RS485
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boseji/serial"
+	"github.com/boseji/serial/internal/timing"
+)
+
+// Matcher is a type of function that checks the data received for a
+// request to an address. It provides the length of the complete response
+// frame or zero if more data is needed, an Error rejects the response.
+type Matcher func(addr int, request, response []byte) (n int, err error)
+
+// Stats of the Transactions with an address
+type Stats struct {
+	Requests  uint32        // Requests sent including the Retries
+	Responses uint32        // Valid responses
+	Retries   uint32        // Requests repeated
+	Timeouts  uint32        // Requests without a complete response
+	Errors    uint32        // Invalid responses and Collisions
+	Failures  uint32        // Transactions failed after all the Retries
+	Latency   time.Duration // From the end of the request to the last valid response
+}
+
+// ErrNoResponse - Addressed node did not respond completely within the
+// response timeout
+var ErrNoResponse = errors.New("no response")
+
+// Defaults of the Transactions
+const (
+	defaultResponseTimeout = 100 * time.Millisecond
+	defaultMaxResponse     = 256
+	defaultSilence         = 2 * time.Millisecond // Baud rate not known
+)
+
+// Transact sends the request to the address and provides its response,
+// the request is repeated for the Retries of the Config on a timeout, an
+// invalid response or a Collision. Transactions are serialized and kept
+// apart by the inter-frame Silence.
+func (p *Port) Transact(ctx context.Context, addr int, request []byte) (response []byte, err error) {
+	if p == nil || len(request) == 0 {
+		return nil, fmt.Errorf("failed to transact empty / un-initialized port")
+	}
+
+	// Only one Transaction on the bus
+	p.bus.Lock()
+	defer p.bus.Unlock()
+
+	for try := 0; ; try++ {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		var retry bool
+		var latency time.Duration
+		response, latency, retry, err = p.transaction(ctx, addr, request)
+		p.record(addr, func(st *Stats) {
+			st.Requests++
+			if try > 0 {
+				st.Retries++
+			}
+			switch {
+			case err == nil:
+				st.Responses++
+				st.Latency = latency
+			case errors.Is(err, ErrNoResponse):
+				st.Timeouts++
+			case retry:
+				st.Errors++
+			}
+			if err != nil && (!retry || try >= p.retries) {
+				st.Failures++
+			}
+		})
+		if err == nil || !retry || try >= p.retries {
+			return response, err
+		}
+	}
+}
+
+// transaction sends the request once and receives the response, it tells
+// if the request can be repeated on an Error
+func (p *Port) transaction(ctx context.Context, addr int, request []byte) ([]byte, time.Duration, bool, error) {
+	// Inter-frame Silence since the last Transaction
+	if err := timing.Sleep(ctx, time.Until(p.last.Add(p.frameSilence()))); err != nil {
+		return nil, 0, false, err
+	}
+	defer func() { p.last = time.Now() }()
+
+	// Data left over from the earlier Transactions
+	err := p.Flush(true, false)
+	if err != nil && !errors.Is(err, serial.ErrNotImplemented) {
+		return nil, 0, false, fmt.Errorf("failed to flush before RS485 Transact - %w", err)
+	}
+
+	_, err = p.WriteContext(ctx, request)
+	if err != nil {
+		return nil, 0, errors.Is(err, ErrCollision), err
+	}
+	start := time.Now()
+	response, retry, err := p.receive(ctx, addr, request)
+	return response, time.Since(start), retry, err
+}
+
+// receive reads the response frame, checked by the Matcher or ended by the
+// inter-frame Silence without it
+func (p *Port) receive(ctx context.Context, addr int, request []byte) ([]byte, bool, error) {
+	rctx, cancel := context.WithTimeout(ctx, p.responseWait())
+	defer cancel()
+
+	buf := make([]byte, p.frameSize())
+	got := 0
+	for got < len(buf) {
+		// Silence after the data ends the frame
+		readCtx, gapCancel := rctx, context.CancelFunc(func() {})
+		if got > 0 && p.matcher == nil {
+			readCtx, gapCancel = context.WithTimeout(rctx, p.frameSilence())
+		}
+		n, err := p.port.ReadContext(readCtx, buf[got:])
+		gapCancel()
+		got += n
+
+		if n > 0 && p.matcher != nil {
+			size, merr := p.matcher(addr, request, buf[:got])
+			if merr != nil {
+				// Rest of the frame is of no use
+				p.port.Flush(true, false)
+				return nil, true, fmt.Errorf("invalid response from address %d - %w", addr, merr)
+			}
+			if size > 0 && size <= got {
+				return buf[:size], false, nil
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if cerr := ctx.Err(); cerr != nil {
+			return nil, false, cerr
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return nil, false, fmt.Errorf("failed to read the RS485 response - %w", err)
+		}
+		if p.matcher == nil && got > 0 {
+			return buf[:got], false, nil
+		}
+		return nil, true, fmt.Errorf("%w from address %d - received %d bytes", ErrNoResponse, addr, got)
+	}
+
+	// Without a Matcher a full buffer is the frame
+	if p.matcher == nil {
+		return buf, false, nil
+	}
+	p.port.Flush(true, false)
+	return nil, true, fmt.Errorf("invalid response from address %d - longer than %d bytes", addr, len(buf))
+}
+
+// responseWait provides the response timeout
+func (p *Port) responseWait() time.Duration {
+	if p.responseTimeout > 0 {
+		return p.responseTimeout
+	}
+	return defaultResponseTimeout
+}
+
+// frameSilence provides the inter-frame Silence, 3.5 Characters at the baud
+// rate and frame format of the Port unless configured
+func (p *Port) frameSilence() time.Duration {
+	if p.silence > 0 {
+		return p.silence
+	}
+	if cfg, err := p.port.Config(); err == nil {
+		return cfg.CharTime() * 7 / 2
+	}
+	return defaultSilence
+}
+
+// frameSize provides the size of the largest response frame
+func (p *Port) frameSize() int {
+	if p.maxResponse > 0 {
+		return p.maxResponse
+	}
+	return defaultMaxResponse
+}
+
+// record updates the Stats of the address
+func (p *Port) record(addr int, update func(st *Stats)) {
+	p.smx.Lock()
+	defer p.smx.Unlock()
+	if p.stats == nil {
+		p.stats = map[int]*Stats{}
+	}
+	st, ok := p.stats[addr]
+	if !ok {
+		st = &Stats{}
+		p.stats[addr] = st
+	}
+	update(st)
+}
+
+// Stats provides the Stats of the Transactions with the address
+func (p *Port) Stats(addr int) Stats {
+	if p == nil {
+		return Stats{}
+	}
+	p.smx.Lock()
+	defer p.smx.Unlock()
+	if st, ok := p.stats[addr]; ok {
+		return *st
+	}
+	return Stats{}
+}
+
+// AllStats provides the Stats of all the addresses used in Transactions
+func (p *Port) AllStats() map[int]Stats {
+	all := map[int]Stats{}
+	if p == nil {
+		return all
+	}
+	p.smx.Lock()
+	defer p.smx.Unlock()
+	for addr, st := range p.stats {
+		all[addr] = *st
+	}
+	return all
+}
+
+// ResetStats clears the Stats of all the addresses
+func (p *Port) ResetStats() {
+	if p == nil {
+		return
+	}
+	p.smx.Lock()
+	defer p.smx.Unlock()
+	p.stats = nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+package RS485
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/boseji/serial"
+	"github.com/stretchr/testify/assert"
+)
+
+// Frames of address, length and data
+func frameMatcher(addr int, request, response []byte) (int, error) {
+	if response[0] != byte(addr) {
+		return 0, errors.New("wrong address")
+	}
+	if len(response) < 2 || len(response) < int(response[1])+2 {
+		return 0, nil
+	}
+	return int(response[1]) + 2, nil
+}
+
+// Node that responds after the given number of requests
+func node(after int, response ...byte) func(b []byte) []byte {
+	count := 0
+	return func(b []byte) []byte {
+		count++
+		if count <= after {
+			return nil
+		}
+		return response
+	}
+}
+
+func TestPort_Transact(t *testing.T) {
+	m := &mockPort{cfg: serial.Config{Baud: 115200}}
+
+	t.Run("Silence", func(t *testing.T) {
+		p, err := NewWithConfig(m, &Config{Kernel: true})
+		assert.NoError(t, err)
+		m.echo = node(0, 'O', 'K')
+		rsp, err := p.Transact(context.Background(), 1, []byte("REQ"))
+		assert.NoError(t, err)
+		assert.Equal(t, "OK", string(rsp))
+		assert.Equal(t, Stats{Requests: 1, Responses: 1, Latency: p.Stats(1).Latency}, p.Stats(1))
+	})
+
+	t.Run("Matcher", func(t *testing.T) {
+		p, err := NewWithConfig(m, &Config{Kernel: true, Matcher: frameMatcher})
+		assert.NoError(t, err)
+		m.echo = node(0, 2, 1, 'A', 'X')
+		rsp, err := p.Transact(context.Background(), 2, []byte("REQ"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{2, 1, 'A'}, rsp)
+
+		// Invalid responses are Retried
+		m.echo = node(0, 3, 1, 'A')
+		_, err = p.Transact(context.Background(), 2, []byte("REQ"))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "wrong address")
+		st := p.Stats(2)
+		assert.Equal(t, uint32(1), st.Errors)
+		assert.Equal(t, uint32(1), st.Failures)
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		p, err := NewWithConfig(m, &Config{
+			Kernel:          true,
+			Matcher:         frameMatcher,
+			ResponseTimeout: 10 * time.Millisecond,
+			Retries:         2,
+		})
+		assert.NoError(t, err)
+		m.echo = node(2, 5, 0)
+		rsp, err := p.Transact(context.Background(), 5, []byte("REQ"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{5, 0}, rsp)
+		st := p.Stats(5)
+		assert.Equal(t, uint32(3), st.Requests)
+		assert.Equal(t, uint32(2), st.Retries)
+		assert.Equal(t, uint32(2), st.Timeouts)
+		assert.Equal(t, uint32(1), st.Responses)
+
+		// No response after all the Retries
+		m.echo = nil
+		_, err = p.Transact(context.Background(), 6, []byte("REQ"))
+		assert.True(t, errors.Is(err, ErrNoResponse))
+		assert.Equal(t, Stats{Requests: 3, Retries: 2, Timeouts: 3, Failures: 1}, p.Stats(6))
+		assert.Equal(t, 2, len(p.AllStats()))
+
+		p.ResetStats()
+		assert.Equal(t, Stats{}, p.Stats(5))
+	})
+
+	t.Run("Spacing", func(t *testing.T) {
+		p, err := NewWithConfig(m, &Config{
+			Kernel:  true,
+			Matcher: frameMatcher,
+			Silence: 20 * time.Millisecond,
+		})
+		assert.NoError(t, err)
+		m.echo = node(0, 1, 0)
+		_, err = p.Transact(context.Background(), 1, []byte("REQ"))
+		assert.NoError(t, err)
+		start := time.Now()
+		_, err = p.Transact(context.Background(), 1, []byte("REQ"))
+		assert.NoError(t, err)
+		assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		p, err := NewWithConfig(m, &Config{Kernel: true, Retries: 5})
+		assert.NoError(t, err)
+		m.echo = nil
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = p.Transact(ctx, 1, []byte("REQ"))
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
+
+func TestPort_TransactContext(t *testing.T) {
+	m := &mockPort{cfg: serial.Config{Baud: 115200}}
+	var c controlLog
+	p, err := NewWithConfig(m, &Config{Control: c.control, Echo: true, Retries: 2})
+	assert.NoError(t, err)
+
+	// Expiry during the Echo read ends the Transaction, the bus is released
+	m.echo = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = p.Transact(ctx, 1, []byte("REQ"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < defaultEchoTimeout)
+	assert.Equal(t, "REQ", string(m.written))
+	assert.Equal(t, false, c[len(c)-1])
+	st := p.Stats(1)
+	assert.Equal(t, uint32(1), st.Requests)
+	assert.Equal(t, uint32(0), st.Errors)
+
+	// Cancelled Context stops the Write
+	m.written = nil
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = p.WriteContext(ctx, []byte("REQ"))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, len(m.written))
+}
@@ -1,6 +1,6 @@
 module github.com/boseji/serial
 
-go 1.14
+go 1.15
 
 require (
 	github.com/stretchr/testify v1.6.1
@@ -0,0 +1,45 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// Package timing provides the precise waits shared by the serial and the
+// RS485 packages, for the timing of the line signals and the turnaround of
+// the half duplex links.
+package timing
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// Durations that are spun instead of Sleeping, as Sleep can overshoot
+const spinLimit = 2 * time.Millisecond
+
+// SleepFor waits precisely for the duration, the last part is spun
+func SleepFor(d time.Duration) {
+	Sleep(context.Background(), d)
+}
+
+// Sleep waits precisely for the duration unless the Context is done, the
+// last part is spun as Sleep can overshoot
+func Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	end := time.Now().Add(d)
+	if d > spinLimit {
+		t := time.NewTimer(d - spinLimit)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	for time.Now().Before(end) {
+		runtime.Gosched()
+	}
+	return nil
+}
@@ -13,6 +13,8 @@
 // As time progresses other architectures would be added.
 //
 // This library is Context based and performs read write asynchronously.
+// Errors of the Port operations other than those of the Context are provided
+// as *PortError.
 //
 // By default this package uses 8 bits (byte) data format for exchange.
 //
@@ -22,12 +24,15 @@
 //
 //  1. All types of BAUD rates
 //  2. Flow Control - Hardware, Software (XON/XOFF)
-//  3. RTS , DTR control
-//  4. CTS , DSR, RING read back
+//  3. RTS , DTR control and timed sequences of them
+//  4. CTS , DSR, RING, DCD read back, change events and Carrier Detect hang up
 //  5. Parity Control - Odd, Even, Mark, Space
 //  6. Stop Bit Control - 1 bit and 2 bits
 //  7. Hardware to Software Signal Inversion for all Signals RTS, CTS, DTR, DSR
-//  8. Sending Break from TX line
+//  8. Sending timed Break from TX line and Break detection
+//  9. Port enumeration with USB details and Hotplug watching
+//  10. Auto-reconnecting Port that restores its configuration
+//  11. RS485 mode of the driver
 //  X. ... More on the way ...
 //
 package serial
@@ -35,15 +40,31 @@ package serial
 //go:generate go run golang.org/x/sys/windows/mkwinsyscall -output zsyscall_windows.go syscall_windows.go
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"time"
+
+	"github.com/boseji/serial/internal/timing"
 )
 
-// DataSize defines the unit data size in bits used for Serial communication
+// DataSize defines the default unit data size in bits used for Serial communication
 const DataSize byte = 8
 
+// Specific Data bits type
+const (
+	// DataBits5 defines 5 data bits in every data unit block
+	DataBits5 byte = 5
+	// DataBits6 defines 6 data bits in every data unit block
+	DataBits6 byte = 6
+	// DataBits7 defines 7 data bits in every data unit block
+	DataBits7 byte = 7
+	// DataBits8 defines 8 data bits in every data unit block
+	DataBits8 byte = 8
+)
+
 // Specific Stop bits type
 const (
 	// StopBits1 defines a single Stop bit sent after every data unit block
@@ -80,11 +101,17 @@ const (
 type Config struct {
 	Name         string
 	Baud         int
-	ReadTimeout  time.Duration // Blocks the Read operation for a specified time
+	DataBits     byte          // Data bits 5 to 8, Zero means DataSize
+	ReadTimeout  time.Duration // Blocks the Read operation for a specified time, returns no data on expiry
 	Parity       byte
 	StopBits     byte
 	Flow         byte
-	SignalInvert bool // Option to invert the RTS/CTS/DTR/DSR Read outs
+	SignalInvert bool   // Option to invert the RTS/CTS/DTR/DSR Read outs
+	LockFile     bool   // Option to also create a UUCP style lock file e.g. LCK..ttyUSB0 (Linux)
+	LockDir      string // Directory for the lock file, defaults to "/var/lock"
+	Carrier      bool   // Option to honour the Carrier Detect (DCD), the Port hangs up on carrier loss (Linux)
+	MarkErrors   bool   // Option to receive the bytes with Errors and the Breaks marked for ReadMarked (Linux)
+	MarkBreaks   bool   // Option to receive only the Breaks marked for ReadMarked, implied by MarkErrors (Linux)
 }
 
 // Default Errors
@@ -100,19 +127,372 @@ var (
 	ErrAlreadyOpen = fmt.Errorf("port is already open")
 	// ErrAccessDenied -
 	ErrAccessDenied = fmt.Errorf("access denied")
+	// ErrDisconnected - Device was removed or hung up, the Port is closed and
+	// the further calls return ErrNotOpen till its opened again, as done by
+	// OpenReconnectPort
+	ErrDisconnected = fmt.Errorf("port disconnected")
+	// ErrBusy - Device is in use e.g. opened exclusively by another process
+	ErrBusy = fmt.Errorf("port busy")
+	// ErrCarrierLost - Carrier Detect (DCD) dropped on a Port configured to
+	// honour the Carrier, the Port is hung up and closed
+	ErrCarrierLost = fmt.Errorf("carrier lost")
 )
 
+// PortError records the Error along with the Operation and the Port that
+// caused it. The System Errors are matched by errors.Is with the Errors of
+// this package, e.g. EBUSY with ErrBusy, EACCES with ErrAccessDenied, EIO
+// with ErrDisconnected and ENOENT with os.ErrNotExist (fs.ErrNotExist).
+type PortError struct {
+	Op   string // Operation e.g. "open", "read", "set baud"
+	Port string // Name of the Port e.g. "/dev/ttyUSB0"
+	Err  error
+}
+
+func (e *PortError) Error() string {
+	if e.Port == "" {
+		return e.Op + ": " + e.Err.Error()
+	}
+	return e.Op + " " + e.Port + ": " + e.Err.Error()
+}
+
+// Unwrap provides the underlying Error
+func (e *PortError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout tells if the underlying Error is a timeout, e.g. of a deadline,
+// so that os.IsTimeout and the net.Error checks keep working
+func (e *PortError) Timeout() bool {
+	var t interface{ Timeout() bool }
+	return errors.As(e.Err, &t) && t.Timeout()
+}
+
+// Is matches the underlying System Error with the Errors of this package
+func (e *PortError) Is(target error) bool {
+	mapped := mapErrno(e.Err)
+	return mapped != nil && mapped == target
+}
+
+// newPortError wraps the Error of the Operation, the Errors of the Context
+// and the ones already wrapped are provided as is
+func newPortError(op, port string, err error) error {
+	if err == nil || err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	var pe *PortError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &PortError{Op: op, Port: port, Err: err}
+}
+
 // Port Type for Multi platform implementation of Serial port functionality
 type Port interface {
 	io.ReadWriteCloser
+	// ReadContext and WriteContext return promptly with the Error of the
+	// Context when its cancelled or its deadline expires
+	ReadContext(ctx context.Context, p []byte) (n int, err error)
+	WriteContext(ctx context.Context, p []byte) (n int, err error)
+	// Deadlines similar to net.Conn, os.ErrDeadlineExceeded on expiry
+	SetDeadline(t time.Time) (err error)
+	SetReadDeadline(t time.Time) (err error)
+	SetWriteDeadline(t time.Time) (err error)
+	// ReadFrame returns once data has arrived and the line has been idle
+	// for the gap, by default 3.5 Characters (Config.CharTime). USB
+	// adapters add their own latency (e.g. 16 mS on FTDI) to the gap.
+	ReadFrame(p []byte, gap time.Duration) (n int, err error)
+	// ReadMarked provides the LineError of each byte, with Config.MarkErrors
+	// or Config.MarkBreaks
+	ReadMarked(ctx context.Context, p []byte, errs []LineError) (n int, err error)
 	Rts(en bool) (err error)
 	Cts() (en bool, err error)
 	Dtr(en bool) (err error)
 	Dsr() (en bool, err error)
 	Ring() (en bool, err error)
+	Dcd() (en bool, err error)
+	// SetBaud falls back to a custom divisor for the non-standard rates on
+	// Linux (e.g. 250000, 74880 or 31250), Baud reads back the rate applied
 	SetBaud(baud int) (err error)
+	Baud() (baud int, err error)
+	SetDataBits(bits byte) (err error)
+	// Reconfigure changes the Settings at once without disturbing the
+	// modem signals, Config reads back the Configuration actually applied
+	Reconfigure(cfg Config) (err error)
+	Config() (cfg Config, err error)
+	// Flush discards the queued data, Drain waits till the data written has
+	// left the UART including its shift register where the driver reports
+	// it (TIOCSERGETLSR on Linux)
+	Flush(in, out bool) (err error)
+	Drain() (err error)
+	DrainContext(ctx context.Context) (err error)
+	// Bytes in the Input and Output queues
+	InWaiting() (n int, err error)
+	OutWaiting() (n int, err error)
+	Counters() (c Counters, err error)
+	// Changes of the Modem input lines instead of polling them, drivers that
+	// can't wait for them (TIOCMIWAIT on Linux) are polled so short pulses
+	// may be missed. The wait in the kernel can't be interrupted, after Close
+	// its goroutine and the device stay busy in the background till the next
+	// change of the lines or the removal of the device.
+	WaitModemChange(ctx context.Context, mask ModemSignal) (changed ModemSignal, err error)
+	ModemEvents(ctx context.Context, mask ModemSignal) (events <-chan ModemEvent, err error)
 	SignalInvert(en bool) (err error)
 	SendBreak(en bool) (err error)
+	// SendBreakFor sends a Break after the pending data for at least a
+	// Character (Config.BreakTime), e.g. for DMX512 and LIN
+	SendBreakFor(d time.Duration) (err error)
+	// SetSignals changes the output lines without disturbing the others,
+	// PulseSignals runs a timed sequence of them e.g. ResetArduino
+	SetSignals(set, clear ModemSignal) (err error)
+	PulseSignals(ctx context.Context, steps []SignalStep) (err error)
+	// SetRS485 provides the settings accepted by the driver, or
+	// ErrNotImplemented where the driver does not support it
+	SetRS485(cfg RS485Config) (applied RS485Config, err error)
+	RS485() (cfg RS485Config, err error)
+}
+
+// RS485Config is the RS485 mode of the driver, where the driver itself
+// drives RTS for the direction of the half duplex transceiver around each
+// transmission. The delays have a resolution of a millisecond.
+type RS485Config struct {
+	Enabled         bool          // RS485 mode of the driver
+	RTSOnSend       bool          // RTS is high while sending
+	RTSAfterSend    bool          // RTS is high after sending
+	DelayBeforeSend time.Duration // Delay from setting RTS to sending
+	DelayAfterSend  time.Duration // Delay from the end of sending to releasing RTS
+	RxDuringTx      bool          // Keep receiving while sending
+	Terminate       bool          // Enable the bus termination, where the board has a GPIO for it
+}
+
+// ModemSignal identifies the Modem lines, they can be combined as a mask
+// to select the lines of interest
+type ModemSignal byte
+
+// Modem input lines, followed by the output lines
+const (
+	// ModemCTS - Clear To Send
+	ModemCTS ModemSignal = 1 << iota
+	// ModemDSR - Data Set Ready
+	ModemDSR
+	// ModemRI - Ring Indicator
+	ModemRI
+	// ModemDCD - Data Carrier Detect
+	ModemDCD
+	// ModemRTS - Request To Send, output
+	ModemRTS
+	// ModemDTR - Data Terminal Ready, output
+	ModemDTR
+	// ModemAll selects all the Modem input lines
+	ModemAll = ModemCTS | ModemDSR | ModemRI | ModemDCD
+	// ModemOutputs selects the Modem output lines
+	ModemOutputs = ModemRTS | ModemDTR
+)
+
+func (m ModemSignal) String() string {
+	names := []string{"CTS", "DSR", "RI", "DCD", "RTS", "DTR"}
+	str := ""
+	for i, name := range names {
+		if m&(1<<i) != 0 {
+			if str != "" {
+				str += "|"
+			}
+			str += name
+		}
+	}
+	if str == "" {
+		return "None"
+	}
+	return str
+}
+
+// SignalStep is a step of a sequence for Port.PulseSignals, the output lines
+// are set and cleared and then held for the duration
+type SignalStep struct {
+	Set   ModemSignal   // Output lines to activate
+	Clear ModemSignal   // Output lines to deactivate
+	Hold  time.Duration // Time to hold the lines before the next step
+}
+
+var (
+	// ResetArduino pulses DTR to reset the boards with the DTR auto-reset
+	// capacitor into their bootloader
+	ResetArduino = []SignalStep{
+		{Clear: ModemDTR | ModemRTS, Hold: 100 * time.Millisecond},
+		{Set: ModemDTR | ModemRTS, Hold: 50 * time.Millisecond},
+	}
+	// ResetESP32 enters the ROM bootloader of the ESP32 / ESP8266 boards
+	// with the RTS on EN and DTR on IO0 transistor pair
+	ResetESP32 = []SignalStep{
+		{Set: ModemRTS, Clear: ModemDTR, Hold: 100 * time.Millisecond},
+		{Set: ModemDTR, Clear: ModemRTS, Hold: 50 * time.Millisecond},
+		{Clear: ModemDTR},
+	}
+)
+
+// checkSignals verifies that only the output lines are set or cleared and
+// not both at once
+func checkSignals(set, clear ModemSignal) error {
+	if (set|clear)&^ModemOutputs != 0 {
+		return fmt.Errorf("only the output lines %v can be set", ModemOutputs)
+	}
+	if set&clear != 0 {
+		return fmt.Errorf("lines %v can't be set and cleared at once", set&clear)
+	}
+	return nil
+}
+
+// pulseSignals runs the sequence of Steps using the set function, a
+// cancelled Context stops it leaving the lines as they are
+func pulseSignals(ctx context.Context, steps []SignalStep, set func(set, clear ModemSignal) error) error {
+	for _, st := range steps {
+		if err := checkSignals(st.Set, st.Clear); err != nil {
+			return err
+		}
+	}
+	for _, st := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := set(st.Set, st.Clear); err != nil {
+			return err
+		}
+		if err := timing.Sleep(ctx, st.Hold); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ModemEvent reports the change of a Modem input line, the level is after
+// the Signal Inversion
+type ModemEvent struct {
+	Signal ModemSignal // Line that changed
+	Rising bool        // Line became active, else inactive
+	Time   time.Time   // Time the change was detected
+}
+
+func (e ModemEvent) String() string {
+	edge := "Falling"
+	if e.Rising {
+		edge = "Rising"
+	}
+	return e.Signal.String() + " " + edge + " at " + e.Time.Format(time.RFC3339Nano)
+}
+
+// LineError flags the Errors of a received byte. On Linux the kernel marks
+// the Parity and Framing errors alike, they are told apart using the driver
+// Counters and both are flagged when that is not possible.
+type LineError byte
+
+// Line Errors
+const (
+	// LineParity - Byte received with a Parity error
+	LineParity LineError = 1 << iota
+	// LineFraming - Byte received with a Framing error i.e. no Stop bit
+	LineFraming
+	// LineBreak - Break condition received, reported as a zero byte
+	LineBreak
+)
+
+func (l LineError) String() string {
+	names := []string{"Parity", "Framing", "Break"}
+	str := ""
+	for i, name := range names {
+		if l&(1<<i) != 0 {
+			if str != "" {
+				str += "|"
+			}
+			str += name
+		}
+	}
+	if str == "" {
+		return "None"
+	}
+	return str
+}
+
+// Counters of the Serial line kept by the driver, they count from the
+// loading of the driver and wrap around, use Counters.Sub to get the
+// change over an interval
+type Counters struct {
+	Rx         uint32 // Bytes received
+	Tx         uint32 // Bytes transmitted
+	Frame      uint32 // Framing errors
+	Parity     uint32 // Parity errors
+	Overrun    uint32 // UART receive FIFO overruns
+	BufOverrun uint32 // Receive buffer overruns in the driver
+	Break      uint32 // Breaks received
+	CTS        uint32 // CTS transitions
+	DSR        uint32 // DSR transitions
+	RI         uint32 // RI transitions
+	DCD        uint32 // DCD transitions
+}
+
+// Sub provides the change of the Counters since prev, correct across a
+// wrap around of the Counters
+func (c Counters) Sub(prev Counters) Counters {
+	return Counters{
+		Rx:         c.Rx - prev.Rx,
+		Tx:         c.Tx - prev.Tx,
+		Frame:      c.Frame - prev.Frame,
+		Parity:     c.Parity - prev.Parity,
+		Overrun:    c.Overrun - prev.Overrun,
+		BufOverrun: c.BufOverrun - prev.BufOverrun,
+		Break:      c.Break - prev.Break,
+		CTS:        c.CTS - prev.CTS,
+		DSR:        c.DSR - prev.DSR,
+		RI:         c.RI - prev.RI,
+		DCD:        c.DCD - prev.DCD,
+	}
+}
+
+// Errors provides the total of the line Errors
+func (c Counters) Errors() uint32 {
+	return c.Frame + c.Parity + c.Overrun + c.BufOverrun
+}
+
+// PortInfo describes a Serial Port found on the System
+type PortInfo struct {
+	Name         string   // Name of the Port e.g. "ttyUSB0"
+	Device       string   // Path used to open the Port e.g. "/dev/ttyUSB0"
+	Driver       string   // Kernel driver e.g. "ftdi_sio", "cdc_acm"
+	IsUSB        bool     // Port belongs to an USB device, following fields are valid
+	VID          uint16   // USB Vendor ID
+	PID          uint16   // USB Product ID
+	SerialNumber string   // USB Serial Number
+	Manufacturer string   // USB Manufacturer
+	Product      string   // USB Product
+	Interface    int      // USB Interface number, -1 if not known
+	Links        []string // Persistent links e.g. "/dev/serial/by-id/usb-FTDI_..."
+}
+
+// ListPorts provides the Serial Ports available on the System
+func ListPorts() ([]PortInfo, error) {
+	return listPorts()
+}
+
+// PortEventType defines the kind of change to a Port
+type PortEventType byte
+
+// Port Event Types
+const (
+	// PortAdded reports a Port that has appeared on the System
+	PortAdded PortEventType = iota + 1
+	// PortRemoved reports a Port that has disappeared from the System
+	PortRemoved
+)
+
+// PortEvent reports a change of the Ports available on the System
+type PortEvent struct {
+	Type PortEventType
+	Port PortInfo
+}
+
+// Watch reports the Ports being Added or Removed till the Context is done,
+// the Ports present at the start are reported as Added. The channel is
+// closed when watching stops.
+func Watch(ctx context.Context) (<-chan PortEvent, error) {
+	return watchPorts(ctx)
 }
 
 // OpenPort is a Function to Create the Serial Port and return an Interface type enclosing the configuration
@@ -120,6 +500,23 @@ func OpenPort(cfg *Config) (Port, error) {
 	return openPort(cfg)
 }
 
+// Internal function to get the Data bits with the Default
+func dataBitsOf(d byte) byte {
+	if d == 0 {
+		return DataSize
+	}
+	return d
+}
+
+// Internal function for Logging of Data bits
+func dataBitStr(d byte) string {
+	d = dataBitsOf(d)
+	if d >= DataBits5 && d <= DataBits8 {
+		return strconv.Itoa(int(d))
+	}
+	return "Unknown " + strconv.Itoa(int(d))
+}
+
 // Internal function for Logging of Stop bits
 func stopBitStr(s byte) string {
 	if s == StopBits1 {
@@ -162,11 +559,46 @@ func flowStr(f byte) string {
 	return "Unknown " + strconv.Itoa(int(f))
 }
 
+// CharTime provides the time taken on the line by a single character including
+// the Start, Data, Parity and Stop bits at the configured Baud rate
+func (c *Config) CharTime() time.Duration {
+	if c.Baud <= 0 {
+		return 0
+	}
+	// Count in Half bits to account for 1.5 Stop bits
+	halfBits := 2 * (1 + int64(dataBitsOf(c.DataBits)))
+	if c.Parity != ParityNone {
+		halfBits += 2
+	}
+	switch c.StopBits {
+	case StopBits15:
+		halfBits += 3
+	case StopBits2:
+		halfBits += 4
+	default:
+		halfBits += 2
+	}
+	return time.Duration(halfBits * int64(time.Second) / (2 * int64(c.Baud)))
+}
+
+// BreakTime provides the duration of a Break of at least d, the line must
+// be held for longer than a Character for the receiver to detect a Break
+func (c *Config) BreakTime(d time.Duration) time.Duration {
+	if c.Baud <= 0 {
+		return d
+	}
+	min := c.CharTime() + time.Second/time.Duration(c.Baud)
+	if d < min {
+		return min
+	}
+	return d
+}
+
 // String is the implementation of the Stringer interface
 func (c *Config) String() string {
 	return fmt.Sprintf(
-		"Port : %q Baud: %d Parity: %s StopBits: %s bits FlowControl: %s SignalInversion: %t",
-		c.Name, c.Baud, parityStr(c.Parity), stopBitStr(c.StopBits),
+		"Port : %q Baud: %d DataBits: %s bits Parity: %s StopBits: %s bits FlowControl: %s SignalInversion: %t",
+		c.Name, c.Baud, dataBitStr(c.DataBits), parityStr(c.Parity), stopBitStr(c.StopBits),
 		flowStr(c.Flow), c.SignalInvert,
 	)
 }
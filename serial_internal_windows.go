@@ -120,21 +120,46 @@ const (
 	modemStatusMask_CTS_ON  = 0x0010
 	modemStatusMask_DSR_ON  = 0x0020
 	modemStatusMask_RING_ON = 0x0040
-	// modemStatusMask_RLSD_ON = 0x0080
+	modemStatusMask_RLSD_ON = 0x0080
 )
 
+/**
+Errors reported for an invalid, busy or removed device on Windows
+*/
+const (
+	errorInvalidHandle      syscall.Errno = 6
+	errorBadCommand         syscall.Errno = 22
+	errorGenFailure         syscall.Errno = 31
+	errorSharingViolation   syscall.Errno = 32
+	errorDeviceNotConnected syscall.Errno = 1167
+	errorDeviceRemoved      syscall.Errno = 1617
+)
+
+// wIsHangup checks if the I/O Error is due to the device being removed
+func wIsHangup(err error) bool {
+	switch err {
+	case syscall.ERROR_ACCESS_DENIED, errorBadCommand, errorGenFailure,
+		errorDeviceNotConnected, errorDeviceRemoved:
+		return true
+	}
+	return false
+}
+
 // DLL Functions
 var (
+	nGetCommState,
 	nSetCommState,
 	nSetCommTimeouts,
 	nSetCommMask,
 	nSetupComm,
-	//nClearCommError,
+	nClearCommError,
+	nPurgeComm,
 	nEscapeCommFunction,
 	nGetCommModemStatus,
 	nGetOverlappedResult,
 	nCreateEvent,
-	nResetEvent uintptr
+	nResetEvent,
+	nCancelIoEx uintptr
 )
 
 // DLL Loader
@@ -158,23 +183,26 @@ func init() {
 	}
 	defer syscall.FreeLibrary(k32)
 
+	nGetCommState = getProcAddr(k32, "GetCommState")
 	nSetCommState = getProcAddr(k32, "SetCommState")
 	nSetCommTimeouts = getProcAddr(k32, "SetCommTimeouts")
 	nSetCommMask = getProcAddr(k32, "SetCommMask")
 	nSetupComm = getProcAddr(k32, "SetupComm")
-	//nClearCommError = getProcAddr(k32, "ClearCommError")
+	nClearCommError = getProcAddr(k32, "ClearCommError")
+	nPurgeComm = getProcAddr(k32, "PurgeComm")
 	nEscapeCommFunction = getProcAddr(k32, "EscapeCommFunction")
 	nGetCommModemStatus = getProcAddr(k32, "GetCommModemStatus")
 	nGetOverlappedResult = getProcAddr(k32, "GetOverlappedResult")
 	nCreateEvent = getProcAddr(k32, "CreateEventW")
 	nResetEvent = getProcAddr(k32, "ResetEvent")
+	nCancelIoEx = getProcAddr(k32, "CancelIoEx")
 }
 
 /**
 Windows Internal Function
 */
 
-func wSetCommState(h syscall.Handle, baud int, stopbits byte, parity byte, flow byte) error {
+func wSetCommState(h syscall.Handle, baud int, databits byte, stopbits byte, parity byte, flow byte) error {
 	var params structDCB
 	params.DCBlength = uint32(unsafe.Sizeof(params))
 
@@ -255,6 +283,11 @@ func wSetCommState(h syscall.Handle, baud int, stopbits byte, parity byte, flow
 		return fmt.Errorf("error in baudrate %d", baud)
 	}
 
+	databits = dataBitsOf(databits)
+	if databits < DataBits5 || databits > DataBits8 {
+		return fmt.Errorf("error in databits %d", databits)
+	}
+
 	if stopbits == StopBits15 {
 		return fmt.Errorf("stopbits %s not supported by many serial ports", stopBitStr(stopbits))
 	}
@@ -262,7 +295,7 @@ func wSetCommState(h syscall.Handle, baud int, stopbits byte, parity byte, flow
 	params.BaudRate = uint32(baud)
 	params.Parity = parityMap[parity]
 	params.StopBits = stopbitMap[stopbits]
-	params.ByteSize = DataSize
+	params.ByteSize = databits
 
 	r, _, err := syscall.Syscall(nSetCommState, 2, uintptr(h), uintptr(unsafe.Pointer(&params)), 0)
 	if r == 0 {
@@ -271,6 +304,52 @@ func wSetCommState(h syscall.Handle, baud int, stopbits byte, parity byte, flow
 	return nil
 }
 
+func wGetCommState(h syscall.Handle) (structDCB, error) {
+	var params structDCB
+	params.DCBlength = uint32(unsafe.Sizeof(params))
+
+	r, _, err := syscall.Syscall(nGetCommState, 2, uintptr(h), uintptr(unsafe.Pointer(&params)), 0)
+	if r == 0 {
+		return structDCB{}, err
+	}
+	return params, nil
+}
+
+func wGetCommBaud(h syscall.Handle) (int, error) {
+	params, err := wGetCommState(h)
+	if err != nil {
+		return 0, err
+	}
+	return int(params.BaudRate), nil
+}
+
+// wGetCommConfig reads back the Settings of the Port in to the Config
+func wGetCommConfig(h syscall.Handle, cfg *Config) error {
+	params, err := wGetCommState(h)
+	if err != nil {
+		return err
+	}
+	cfg.Baud = int(params.BaudRate)
+	cfg.DataBits = params.ByteSize
+	for k, v := range parityMap {
+		if v == params.Parity {
+			cfg.Parity = k
+		}
+	}
+	for k, v := range stopbitMap {
+		if v == params.StopBits {
+			cfg.StopBits = k
+		}
+	}
+	cfg.Flow = FlowNone
+	if params.flags[0]&(1<<2) != 0 { // fOutxCtsFlow
+		cfg.Flow = FlowHardware
+	} else if params.flags[1]&0x3 != 0 { // fOutX, fInX
+		cfg.Flow = FlowSoft
+	}
+	return nil
+}
+
 func wSetCommTimeouts(h syscall.Handle) error {
 	var timeouts structTimeouts
 	const MAXDWORD = 1<<32 - 1
@@ -367,3 +446,48 @@ func wResetEvent(h syscall.Handle) error {
 	}
 	return nil
 }
+
+/**
+PurgeComm Flags
+*/
+const (
+	purgeTxClear uint32 = 0x0004
+	purgeRxClear uint32 = 0x0008
+)
+
+func wPurgeComm(h syscall.Handle, flags uint32) error {
+	r, _, err := syscall.Syscall(nPurgeComm, 2, uintptr(h), uintptr(flags), 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// Communications device Status from ClearCommError
+type structComStat struct {
+	flags    uint32
+	cbInQue  uint32
+	cbOutQue uint32
+}
+
+// wGetCommQueues provides the Number of bytes in the Input and Output queues
+func wGetCommQueues(h syscall.Handle) (in, out int, err error) {
+	var errors uint32
+	var stat structComStat
+	r, _, err := syscall.Syscall(nClearCommError, 3,
+		uintptr(h),
+		uintptr(unsafe.Pointer(&errors)),
+		uintptr(unsafe.Pointer(&stat)))
+	if r == 0 {
+		return 0, 0, err
+	}
+	return int(stat.cbInQue), int(stat.cbOutQue), nil
+}
+
+func wCancelIoEx(h syscall.Handle, overlapped *syscall.Overlapped) error {
+	r, _, err := syscall.Syscall(nCancelIoEx, 2, uintptr(h), uintptr(unsafe.Pointer(overlapped)), 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
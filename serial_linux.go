@@ -8,11 +8,17 @@
 package serial
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os/exec"
+	"io"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
 	"unsafe"
 
+	"github.com/boseji/serial/internal/timing"
 	"golang.org/x/sys/unix"
 )
 
@@ -20,14 +26,36 @@ import (
 type serialPort struct {
 	// Handle
 	fd int
-	// Lock for Handle - Make it Thread Safe by Default
+	// File on the Handle for the Runtime Poller
+	f *os.File
+	// UUCP style Lock file held for the Port
+	lock string
+	// Lock for Handle and Configuration - Make it Thread Safe by Default
 	mx sync.Mutex
+	// Lock for Readers - Read and Write can run in parallel
+	rl sync.Mutex
+	// Lock for Writers
+	wl sync.Mutex
+	// Read Deadline
+	rd time.Time
+	// Write Deadline
+	wd time.Time
 	// If Port is Open
 	opened bool
 	// Invert Modem signals
 	sigInv bool
 	// Configuration
 	conf Config
+	// Monitor for the Modem line changes
+	modem *modemMonitor
+	// If the Errors are marked in the received data (PARMRK)
+	marked bool
+	// Counters when the marked Errors were last classified
+	count   Counters
+	countOK bool
+	// Decoder for the marked data and its Buffer - under the Reader Lock
+	mark markDecoder
+	raw  []byte
 }
 
 // Platform Specific Open Port Function
@@ -37,45 +65,35 @@ func openPort(cfg *Config) (Port, error) {
 	// Interpret the Config for Potential Errors
 	t, err := getTermiosFor(cfg)
 	if err != nil {
-		return nil, err
+		return nil, newPortError("open", cfg.Name, err)
 	}
 
+	// Set the Configuration
+	s.conf = *cfg
+
 	// Open Port
 	err = s.Open(cfg.Name)
 	if err != nil {
 		return nil, err
 	}
 
-	// Auto Close on Errors
-	defer func(fd int, err error) {
-		if fd != 0 && err != nil {
-			unix.Close(fd)
-			s.fd = 0 // Not Initialized state
-			s.opened = false
-		}
-	}(s.fd, err)
-
 	// Set Terminos
 	err = s.SetTermios(t)
 	if err != nil {
-		return nil, err
+		// Release the Port and its Locks
+		s.Close()
+		return nil, newPortError("open", cfg.Name, err)
 	}
 
-	// Set the Configuration
-	s.conf = *cfg
 	s.SignalInvert(cfg.SignalInvert) // No Errors Expected here
 
-	// Set Non-Blocking for Timeout and Blocking Purposes
-	err = unix.SetNonblock(s.fd, false)
-	if err != nil {
-		return nil, err
-	}
-
 	// Finally Success
 	return s, err
 }
 
-func (s *serialPort) Open(name string) error {
+func (s *serialPort) Open(name string) (err error) {
+	defer s.wrapError("open", &err)
+
 	// Establish Lock
 	s.mx.Lock()
 	defer s.mx.Unlock()
@@ -90,13 +108,17 @@ func (s *serialPort) Open(name string) error {
 		s.mx.Lock()
 	}
 
-	// Check if Port is already open
-	err := exec.Command("lsof", "-t", name).Run()
-	// This is ODD but yes if there is no error then we know port is open
-	if err == nil {
-		return ErrAlreadyOpen
-	} else if err.Error() != "exit status 1" {
-		return ErrAccessDenied
+	// Name for the Errors
+	s.conf.Name = name
+
+	// UUCP style Lock file if Configured
+	lock := ""
+	if s.conf.LockFile {
+		lock = lockFileName(s.conf.LockDir, name)
+		err := acquireLockFile(lock)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Try to Open
@@ -106,79 +128,370 @@ func (s *serialPort) Open(name string) error {
 		0,
 	)
 	if err != nil {
+		if lock != "" {
+			os.Remove(lock)
+		}
+		return openBusy(name, err)
+	}
+
+	// Check if Port is already open by a Cooperating process
+	err = lockPort(fd)
+	if err == nil {
+		// Get Exclusive Access
+		if _, _, e1 := unix.Syscall(
+			unix.SYS_IOCTL,
+			uintptr(fd),
+			uintptr(unix.TIOCEXCL),
+			0,
+		); e1 != 0 {
+			err = e1
+		}
+	}
+	// Auto Close on Errors
+	if err != nil {
+		unix.Close(fd)
+		if lock != "" {
+			os.Remove(lock)
+		}
 		return err
 	}
-	// Assign fd
+
+	// Assign fd - Kept Non-Blocking so that the Runtime Poller handles
+	// the Blocking, Timeout and Context cancellation of Read and Write
 	s.fd = fd
+	s.f = os.NewFile(uintptr(fd), name)
+	s.lock = lock
+	s.modem = newModemMonitor(s.GetModemSignals, s.waitModemLines, s.isInverted)
 	s.opened = true
+	return nil
+}
 
-	// Auto Close on Errors
-	defer func(fd int, err error) {
-		if fd != 0 && err != nil {
-			unix.Close(fd)
-			s.fd = 0 // Not Initialized state
-			s.opened = false
+func (s *serialPort) Read(p []byte) (n int, err error) {
+	return s.ReadContext(context.Background(), p)
+}
+
+func (s *serialPort) ReadContext(ctx context.Context, p []byte) (n int, err error) {
+	defer s.wrapError("read", &err)
+
+	// Only one Reader at a time
+	s.rl.Lock()
+	defer s.rl.Unlock()
+
+	return s.read(ctx, p, nil, 0)
+}
+
+func (s *serialPort) ReadFrame(p []byte, gap time.Duration) (n int, err error) {
+	defer s.wrapError("read frame", &err)
+
+	// Only one Reader at a time
+	s.rl.Lock()
+	defer s.rl.Unlock()
+
+	// Default gap of 3.5 Characters for the Frame format
+	if gap <= 0 {
+		s.mx.Lock()
+		gap = s.conf.CharTime() * 7 / 2
+		s.mx.Unlock()
+	}
+
+	// Wait for the Start of the Frame
+	n, err = s.read(context.Background(), p, nil, 0)
+
+	// Collect till the Line is idle for the gap
+	for err == nil && n > 0 && n < len(p) {
+		var m int
+		m, err = s.read(context.Background(), p[n:], nil, gap)
+		if m == 0 {
+			break
 		}
-	}(fd, err)
+		n += m
+	}
+	return n, err
+}
 
-	// Get Exclusive Access
-	if _, _, e1 := unix.Syscall(
-		unix.SYS_IOCTL,
-		uintptr(fd),
-		uintptr(unix.TIOCEXCL),
-		0,
-	); e1 != 0 {
-		return fmt.Errorf("failed to get exclusive access - %v", e1)
+// read performs the Read under the Reader Lock, the wait for data is
+// limited by the timeout and Zero uses the Read Timeout from Configuration.
+// The Errors of each byte are provided in errs unless its nil.
+func (s *serialPort) read(ctx context.Context, p []byte, errs []LineError, timeout time.Duration) (n int, err error) {
+	// Get the File and the Timeout from the Configuration
+	f, cfgTimeout, err := s.ioFile()
+	if err != nil {
+		return 0, err
+	}
+	// Marked data is Read for decoding
+	buf := p
+	marked := s.markMode()
+	if marked {
+		if cap(s.raw) < len(p) {
+			s.raw = make([]byte, len(p))
+		}
+		buf = s.raw[:len(p)]
+	} else {
+		s.mark = markDecoder{}
+	}
+	if timeout <= 0 {
+		timeout = cfgTimeout
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	// Read Deadline if its earlier
+	if d := s.deadline(&s.rd); !d.IsZero() && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
 	}
 
-	return err
+	// Perform the Actual Read
+	for {
+		size := len(buf)
+		if marked {
+			size = s.mark.room(len(p))
+		}
+		var raw int
+		if size > 0 {
+			raw, err = ioContext(ctx, f.SetReadDeadline, deadline, func() (int, error) {
+				return f.Read(buf[:size])
+			})
+		}
+		if !marked {
+			n = raw
+			break
+		}
+		var flagged int
+		n, flagged = s.mark.decode(buf[:raw], p, errs)
+		if flagged > 0 && errs != nil {
+			s.classify(errs[:n])
+		}
+		// Escape split across the Reads gives no data yet
+		if n > 0 || raw == 0 || err != nil {
+			break
+		}
+	}
+	if !marked && errs != nil {
+		for i := range errs[:n] {
+			errs[i] = 0
+		}
+	}
+	if isHangup(err) {
+		carrier := s.carrierLost(f)
+		s.disconnect(f)
+		if carrier {
+			return n, ErrCarrierLost
+		}
+		return n, ErrDisconnected
+	}
+	if err != nil && err != context.DeadlineExceeded && os.IsTimeout(err) {
+		// Read Deadline has Expired
+		if d := s.deadline(&s.rd); !d.IsZero() && !time.Now().Before(d) {
+			return n, os.ErrDeadlineExceeded
+		}
+		// Timeout is not an Error, only no data
+		err = nil
+	}
+	return n, ioError(err)
 }
 
-func (s *serialPort) Read(p []byte) (n int, err error) {
+func (s *serialPort) Write(p []byte) (n int, err error) {
+	return s.WriteContext(context.Background(), p)
+}
+
+func (s *serialPort) WriteContext(ctx context.Context, p []byte) (n int, err error) {
+	defer s.wrapError("write", &err)
+
+	// Only one Writer at a time
+	s.wl.Lock()
+	defer s.wl.Unlock()
+
+	// Get the File
+	f, _, err := s.ioFile()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err = ioContext(ctx, f.SetWriteDeadline, s.deadline(&s.wd), func() (int, error) {
+		return f.Write(p)
+	})
+	if isHangup(err) {
+		s.disconnect(f)
+		return n, ErrDisconnected
+	}
+	if err != nil && err != context.DeadlineExceeded && os.IsTimeout(err) {
+		// Write Deadline has Expired
+		err = os.ErrDeadlineExceeded
+	}
+	return n, ioError(err)
+}
+
+func (s *serialPort) SetDeadline(t time.Time) error {
+	err := s.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+	return s.SetWriteDeadline(t)
+}
+
+func (s *serialPort) SetReadDeadline(t time.Time) (err error) {
+	defer s.wrapError("set read deadline", &err)
+
 	// Establish Lock
 	s.mx.Lock()
 	defer s.mx.Unlock()
 
 	// Check If its Open
-	if !s.opened {
-		return 0, ErrNotOpen
+	if !s.opened || s.f == nil {
+		return ErrNotOpen
 	}
 
-	// Loop to Access the Port Data
-	for {
-		// Perform the Actual Read
-		n, err = unix.Read(s.fd, p)
-		// In case the Read was interrupted by a Signal
-		if err == unix.EINTR {
-			continue
-		}
-		// In Case of Negative values of n due to other errors
-		if n < 0 {
-			n = 0 // Don't let -1 pass on
-		}
-		return n, err
+	// Store for the next Read and Apply to any pending Read
+	s.rd = t
+	return s.f.SetReadDeadline(t)
+}
+
+func (s *serialPort) SetWriteDeadline(t time.Time) (err error) {
+	defer s.wrapError("set write deadline", &err)
+
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	// Check If its Open
+	if !s.opened || s.f == nil {
+		return ErrNotOpen
 	}
+
+	// Store for the next Write and Apply to any pending Write
+	s.wd = t
+	return s.f.SetWriteDeadline(t)
 }
 
-func (s *serialPort) Write(p []byte) (n int, err error) {
+// ioFile provides the File and Read Timeout for I/O outside the Lock, so
+// that a blocked Read does not stall Write or the Configuration calls
+func (s *serialPort) ioFile() (f *os.File, timeout time.Duration, err error) {
 	// Establish Lock
 	s.mx.Lock()
 	defer s.mx.Unlock()
 
 	// Check If its Open
-	if !s.opened {
-		return 0, ErrNotOpen
+	if !s.opened || s.f == nil {
+		return nil, 0, ErrNotOpen
 	}
+	return s.f, s.conf.ReadTimeout, nil
+}
 
-	n, err = unix.Write(s.fd, p)
-	// In case -1 returned - don't pass it on
-	if n < 0 {
-		n = 0
+// deadline provides the Read or Write deadline under the Lock
+func (s *serialPort) deadline(d *time.Time) time.Time {
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return *d
+}
+
+// ioError converts the Error of I/O aborted by a parallel Close
+func ioError(err error) error {
+	if errors.Is(err, os.ErrClosed) {
+		return ErrNotOpen
 	}
-	return n, err
+	return err
+}
+
+// wrapError converts the Error of the Operation to PortError, its deferred
+// ahead of taking the Lock as the Port name is read under the Lock
+func (s *serialPort) wrapError(op string, err *error) {
+	if *err == nil {
+		return
+	}
+	s.mx.Lock()
+	name := s.conf.Name
+	s.mx.Unlock()
+	*err = newPortError(op, name, *err)
+}
+
+// mapErrno provides the Error matching the System Error for PortError
+func mapErrno(err error) error {
+	var errno unix.Errno
+	if !errors.As(err, &errno) {
+		return nil
+	}
+	switch errno {
+	case unix.EBUSY:
+		return ErrBusy
+	case unix.EACCES, unix.EPERM:
+		return ErrAccessDenied
+	case unix.EIO, unix.ENODEV, unix.ENXIO:
+		return ErrDisconnected
+	case unix.EBADF:
+		return ErrNotOpen
+	}
+	return nil
+}
+
+// isHangup checks if the I/O Error is due to the device being removed or
+// hung up, the Poller wakes up on POLLHUP and the Read reports it as
+// End of File (no data with VMIN=1) or EIO, a removed device gives ENODEV
+func isHangup(err error) bool {
+	return err == io.EOF ||
+		errors.Is(err, unix.EIO) ||
+		errors.Is(err, unix.ENODEV) ||
+		errors.Is(err, unix.ENXIO)
+}
+
+// disconnect closes the Port after a hang up, unless it was already closed
+// or opened again with a different File in the meantime
+func (s *serialPort) disconnect(f *os.File) {
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if !s.opened || s.f != f {
+		return
+	}
+	s.close() // Device is gone so Errors are Expected
+}
+
+// carrierLost checks if a hang up is due to the loss of Carrier on a Port
+// honouring it, rather than the removal of the device. The hung up File
+// can't be used anymore, so the device is opened again to read DCD. The
+// drivers refuse the open once they have seen the removal, even while the
+// device node is still there.
+func (s *serialPort) carrierLost(f *os.File) bool {
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if !s.opened || s.f != f || !s.conf.Carrier {
+		return false
+	}
+	fd, err := unix.Open(s.conf.Name, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err == unix.EBUSY {
+		// Still held exclusively (TIOCEXCL), the device is present while
+		// the driver keeps it in the sysfs
+		dev := filepath.Join(sysfsRoot, "class", "tty", filepath.Base(s.conf.Name), "device")
+		_, err = os.Stat(dev)
+		return err == nil
+	}
+	if err != nil {
+		return false
+	}
+	defer unix.Close(fd)
+	status, err := unix.IoctlGetInt(fd, unix.TIOCMGET)
+	if err != nil {
+		// Driver without the Modem lines
+		return isUnsupported(err)
+	}
+	return status&unix.TIOCM_CD == 0
 }
 
-func (s *serialPort) Close() error {
+// isInverted provides the Signal Inversion setting under the Lock
+func (s *serialPort) isInverted() bool {
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.sigInv
+}
+
+func (s *serialPort) Close() (err error) {
+	defer s.wrapError("close", &err)
+
 	// Establish Lock
 	s.mx.Lock()
 	defer s.mx.Unlock()
@@ -188,11 +501,27 @@ func (s *serialPort) Close() error {
 		return ErrPortNotInitialized
 		// return nil
 	}
+	return s.close()
+}
 
+// close releases the Port under the Lock, the File is closed even if
+// the Exclusive Access can't be released e.g. for a removed device
+func (s *serialPort) close() (err error) {
 	// Auto Run at the End of the function
 	defer func() {
+		// Release the Lock file
+		if s.lock != "" {
+			os.Remove(s.lock)
+			s.lock = ""
+		}
+		// End the Modem line Subscriptions
+		if s.modem != nil {
+			s.modem.stop()
+		}
 		s.fd = 0
+		s.f = nil
 		s.opened = false
+		s.marked = false
 	}()
 
 	// Release Exclusive Access
@@ -202,36 +531,37 @@ func (s *serialPort) Close() error {
 		uintptr(unix.TIOCNXCL),
 		0,
 	); e1 != 0 {
-		return fmt.Errorf("failed to release exclusive access - %v", e1)
+		err = e1
 	}
+	// Device stays open till a wait for the Modem lines ends, the Port
+	// is not to stay locked till then
+	unix.Flock(s.fd, unix.LOCK_UN)
 
 	// Perform the Actual Close
-	return unix.Close(s.fd)
+	var cerr error
+	if s.f != nil {
+		cerr = s.f.Close()
+	} else {
+		cerr = unix.Close(s.fd)
+	}
+	if err == nil {
+		err = cerr
+	}
+	return err
 }
 
 func (s *serialPort) Rts(en bool) (err error) {
-	// Signal Inversion
-	if s.sigInv {
-		en = !en
-	}
+	defer s.wrapError("rts", &err)
 
-	// Get the Signals
-	status, err := s.GetModemSignals()
-	if err != nil {
-		return err
-	}
-
-	// Apply the Values to Arg
-	status &^= unix.TIOCM_RTS
 	if en {
-		status |= unix.TIOCM_RTS
+		return s.setSignals(ModemRTS, 0)
 	}
-
-	// Set the Signal
-	return s.SetModemSignal(status)
+	return s.setSignals(0, ModemRTS)
 }
 
 func (s *serialPort) Cts() (en bool, err error) {
+	defer s.wrapError("cts", &err)
+
 	// Signal
 	en = false
 	// Modem Side
@@ -246,35 +576,47 @@ func (s *serialPort) Cts() (en bool, err error) {
 	}
 
 	// Signal Inversion
-	if s.sigInv {
+	if s.isInverted() {
 		en = !en
 	}
 	return en, nil
 }
 
 func (s *serialPort) Dtr(en bool) (err error) {
-	// Signal Inversion
-	if s.sigInv {
-		en = !en
+	defer s.wrapError("dtr", &err)
+
+	if en {
+		return s.setSignals(ModemDTR, 0)
 	}
+	return s.setSignals(0, ModemDTR)
+}
+
+func (s *serialPort) Dsr() (en bool, err error) {
+	defer s.wrapError("dsr", &err)
 
-	// Get the Signals
+	// Signal
+	en = false
+	// Modem Side
 	status, err := s.GetModemSignals()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// Apply the Values to Arg
-	status &^= unix.TIOCM_DTR
-	if en {
-		status |= unix.TIOCM_DTR
+	// Get Status
+	if (status & unix.TIOCM_DSR) != 0 {
+		en = true
 	}
 
-	// Set the Signal
-	return s.SetModemSignal(status)
+	// Signal Inversion
+	if s.isInverted() {
+		en = !en
+	}
+	return en, nil
 }
 
-func (s *serialPort) Dsr() (en bool, err error) {
+func (s *serialPort) Ring() (en bool, err error) {
+	defer s.wrapError("ring", &err)
+
 	// Signal
 	en = false
 	// Modem Side
@@ -284,18 +626,20 @@ func (s *serialPort) Dsr() (en bool, err error) {
 	}
 
 	// Get Status
-	if (status & unix.TIOCM_DSR) != 0 {
+	if (status & unix.TIOCM_RI) != 0 {
 		en = true
 	}
 
 	// Signal Inversion
-	if s.sigInv {
+	if s.isInverted() {
 		en = !en
 	}
 	return en, nil
 }
 
-func (s *serialPort) Ring() (en bool, err error) {
+func (s *serialPort) Dcd() (en bool, err error) {
+	defer s.wrapError("dcd", &err)
+
 	// Signal
 	en = false
 	// Modem Side
@@ -305,18 +649,20 @@ func (s *serialPort) Ring() (en bool, err error) {
 	}
 
 	// Get Status
-	if (status & unix.TIOCM_RI) != 0 {
+	if (status & unix.TIOCM_CD) != 0 {
 		en = true
 	}
 
 	// Signal Inversion
-	if s.sigInv {
+	if s.isInverted() {
 		en = !en
 	}
 	return en, nil
 }
 
 func (s *serialPort) SetBaud(baud int) (err error) {
+	defer s.wrapError("set baud", &err)
+
 	// Already done in the GetTermios and SetTermios
 
 	// Establish Lock
@@ -328,13 +674,49 @@ func (s *serialPort) SetBaud(baud int) (err error) {
 	// 	return ErrNotOpen
 	// }
 
-	// Default Baud rate
-	baudSet, err := linuxFindBaud(baud)
+	// Termios
+	var t unix.Termios
+	// Get Values
+	t, err = s.GetTermios()
 	if err != nil {
 		return err
 	}
 
-	// Process the Given Baud Rates
+	// Set Baud rate - Standard or Custom
+	err = setTermiosBaud(&t, baud)
+	if err != nil {
+		return err
+	}
+
+	// Set Values
+	err = s.SetTermios(t)
+	if err != nil {
+		return err
+	}
+	// Store the Baud
+	s.mx.Lock()
+	s.conf.Baud = baud
+	s.mx.Unlock()
+	return nil
+}
+
+func (s *serialPort) Baud() (baud int, err error) {
+	defer s.wrapError("baud", &err)
+
+	// Termios
+	var t unix.Termios
+	// Get Values
+	t, err = s.GetTermios()
+	if err != nil {
+		return 0, err
+	}
+
+	// Driver reports the Actual Output speed in use
+	return int(t.Ospeed), nil
+}
+
+func (s *serialPort) SetDataBits(bits byte) (err error) {
+	defer s.wrapError("set data bits", &err)
 
 	// Termios
 	var t unix.Termios
@@ -344,23 +726,90 @@ func (s *serialPort) SetBaud(baud int) (err error) {
 		return err
 	}
 
-	// Set Baud rate
-	t.Cflag &^= unix.CBAUD | unix.CBAUDEX
-	t.Cflag |= uint32(baudSet)
-	t.Ospeed = uint32(baudSet)
-	t.Ispeed = uint32(baudSet)
+	// Set Data bits
+	err = setTermiosDataBits(&t, bits)
+	if err != nil {
+		return err
+	}
 
 	// Set Values
 	err = s.SetTermios(t)
 	if err != nil {
 		return err
 	}
-	// Store the Baud
-	s.conf.Baud = baud
+	// Store the Data bits
+	s.mx.Lock()
+	s.conf.DataBits = bits
+	s.mx.Unlock()
+	return nil
+}
+
+func (s *serialPort) Reconfigure(cfg Config) (err error) {
+	defer s.wrapError("reconfigure", &err)
+
+	// Interpret the Config for Potential Errors
+	t, err := getTermiosFor(&cfg)
+	if err != nil {
+		return err
+	}
+
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	// Check If its Open
+	if !s.opened {
+		return ErrNotOpen
+	}
+	if cfg.Name != "" && cfg.Name != s.conf.Name {
+		return fmt.Errorf("port name can't be changed to %q", cfg.Name)
+	}
+
+	// Apply all the Settings at once
+	err = s.setTermios(t)
+	if err != nil {
+		return err
+	}
+
+	// Port Name and Locking stay as Opened
+	cfg.Name = s.conf.Name
+	cfg.LockFile = s.conf.LockFile
+	cfg.LockDir = s.conf.LockDir
+	s.conf = cfg
+	s.sigInv = cfg.SignalInvert
 	return nil
 }
 
+func (s *serialPort) Config() (cfg Config, err error) {
+	defer s.wrapError("config", &err)
+
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	// Check If its Open
+	if !s.opened {
+		return Config{}, ErrNotOpen
+	}
+
+	// Applied Settings
+	t, err := s.getTermios()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg = s.conf
+	cfg.SignalInvert = s.sigInv
+	configFromTermios(&cfg, &t)
+	return cfg, nil
+}
+
 func (s *serialPort) SignalInvert(en bool) (err error) {
+	defer s.wrapError("signal invert", &err)
+
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
 	// Check If its Open
 	if !s.opened {
 		return ErrNotOpen
@@ -370,6 +819,8 @@ func (s *serialPort) SignalInvert(en bool) (err error) {
 }
 
 func (s *serialPort) SendBreak(en bool) (err error) {
+	defer s.wrapError("send break", &err)
+
 	// Establish Lock
 	s.mx.Lock()
 	defer s.mx.Unlock()
@@ -396,7 +847,74 @@ func (s *serialPort) SendBreak(en bool) (err error) {
 	return err
 }
 
+func (s *serialPort) SendBreakFor(d time.Duration) (err error) {
+	defer s.wrapError("send break", &err)
+
+	// No Writes during the Break
+	s.wl.Lock()
+	defer s.wl.Unlock()
+
+	// Break follows the pending data
+	err = s.drain(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// Get the File - Break runs outside the Lock as it can take long
+	f, _, err := s.ioFile()
+	if err != nil {
+		return err
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	s.mx.Lock()
+	d = s.conf.BreakTime(d)
+	s.mx.Unlock()
+
+	// Hold the Break for the duration
+	brk := func(req uint) error {
+		cerr := rc.Control(func(fd uintptr) {
+			err = unix.IoctlSetInt(int(fd), req, 0)
+		})
+		if cerr != nil {
+			return ioError(cerr)
+		}
+		return err
+	}
+	err = brk(unix.TIOCSBRK)
+	if err != nil {
+		return err
+	}
+	timing.SleepFor(d)
+	return brk(unix.TIOCCBRK)
+}
+
 func (s *serialPort) FlushRx() (err error) {
+	return s.Flush(true, false)
+}
+
+func (s *serialPort) FlushTx() (err error) {
+	return s.Flush(false, true)
+}
+
+func (s *serialPort) Flush(in, out bool) (err error) {
+	defer s.wrapError("flush", &err)
+
+	// Queues to Discard
+	var queue int
+	switch {
+	case in && out:
+		queue = unix.TCIOFLUSH
+	case in:
+		queue = unix.TCIFLUSH
+	case out:
+		queue = unix.TCOFLUSH
+	default:
+		return nil
+	}
+
 	// Establish Lock
 	s.mx.Lock()
 	defer s.mx.Unlock()
@@ -406,24 +924,191 @@ func (s *serialPort) FlushRx() (err error) {
 		return ErrNotOpen
 	}
 
-	err = unix.IoctlSetInt(s.fd, unix.TCIOFLUSH, unix.TCIFLUSH)
+	err = unix.IoctlSetInt(s.fd, unix.TCFLSH, queue)
 	// Return the Error
 	return
 }
 
-func (s *serialPort) FlushTx() (err error) {
+func (s *serialPort) Drain() (err error) {
+	return s.DrainContext(context.Background())
+}
+
+func (s *serialPort) DrainContext(ctx context.Context) (err error) {
+	defer s.wrapError("drain", &err)
+
+	return s.drain(ctx)
+}
+
+// drain waits for the Output to be sent
+func (s *serialPort) drain(ctx context.Context) (err error) {
+	// Check if already Cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Get the File - Drain runs outside the Lock as it can take long
+	f, _, err := s.ioFile()
+	if err != nil {
+		return err
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	s.mx.Lock()
+	charTime := s.conf.CharTime()
+	s.mx.Unlock()
+
+	// Wait for the Output queue to empty, checking the Context
+	for {
+		var n int
+		cerr := rc.Control(func(fd uintptr) {
+			n, err = unix.IoctlGetInt(int(fd), unix.TIOCOUTQ)
+		})
+		if cerr != nil {
+			return ioError(cerr)
+		}
+		if err != nil || n == 0 {
+			break
+		}
+		// Time to send the remaining Characters within limits
+		wait := charTime * time.Duration(n)
+		if wait < time.Millisecond {
+			wait = time.Millisecond
+		} else if wait > drainPollMax {
+			wait = drainPollMax
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Wait for the Last Character to leave the Shift register
+	cerr := rc.Control(func(fd uintptr) {
+		err = unix.IoctlSetInt(int(fd), unix.TCSBRK, 1)
+	})
+	if cerr != nil {
+		return ioError(cerr)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Not all the drivers wait for the Transmitter to be empty, check it
+	// where the driver reports it
+	poll := charTime / 2
+	if poll < 10*time.Microsecond {
+		poll = 10 * time.Microsecond
+	} else if poll > time.Millisecond {
+		poll = time.Millisecond
+	}
+	limit := time.Now().Add(temtWaitChars*charTime + time.Millisecond)
+	for {
+		var lsr int
+		cerr = rc.Control(func(fd uintptr) {
+			lsr, err = unix.IoctlGetInt(int(fd), unix.TIOCSERGETLSR)
+		})
+		if cerr != nil {
+			return ioError(cerr)
+		}
+		if err != nil {
+			if isUnsupported(err) {
+				return nil
+			}
+			return err
+		}
+		if lsr&unix.TIOCSER_TEMT != 0 || !time.Now().Before(limit) {
+			return nil
+		}
+		if err := timing.Sleep(ctx, poll); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *serialPort) InWaiting() (n int, err error) {
+	defer s.wrapError("in waiting", &err)
+	return s.queueDepth(unix.TIOCINQ)
+}
+
+func (s *serialPort) OutWaiting() (n int, err error) {
+	defer s.wrapError("out waiting", &err)
+	return s.queueDepth(unix.TIOCOUTQ)
+}
+
+// queueDepth provides the Number of bytes in the Input or Output queue
+func (s *serialPort) queueDepth(req uint) (n int, err error) {
 	// Establish Lock
 	s.mx.Lock()
 	defer s.mx.Unlock()
 
 	// Check If its Open
 	if !s.opened {
-		return ErrNotOpen
+		return 0, ErrNotOpen
 	}
+	return unix.IoctlGetInt(s.fd, req)
+}
 
-	err = unix.IoctlSetInt(s.fd, unix.TCIOFLUSH, unix.TCOFLUSH)
-	// Return the Error
-	return
+// serialICounter is the Linux serial_icounter_struct
+type serialICounter struct {
+	cts, dsr, rng, dcd int32
+	rx, tx             int32
+	frame, overrun     int32
+	parity, brk        int32
+	bufOverrun         int32
+	reserved           [9]int32
+}
+
+func (s *serialPort) Counters() (c Counters, err error) {
+	defer s.wrapError("counters", &err)
+
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	// Check If its Open
+	if !s.opened {
+		return Counters{}, ErrNotOpen
+	}
+	return s.counters()
+}
+
+// counters reads the Counters under the Lock
+func (s *serialPort) counters() (Counters, error) {
+	var ic serialICounter
+	if _, _, e1 := unix.Syscall(
+		unix.SYS_IOCTL,
+		uintptr(s.fd),
+		uintptr(unix.TIOCGICOUNT),
+		uintptr(unsafe.Pointer(&ic)),
+	); e1 != 0 {
+		return Counters{}, e1
+	}
+	return countersFrom(&ic), nil
+}
+
+// countersFrom converts the Counters of the driver
+func countersFrom(ic *serialICounter) Counters {
+	return Counters{
+		Rx:         uint32(ic.rx),
+		Tx:         uint32(ic.tx),
+		Frame:      uint32(ic.frame),
+		Parity:     uint32(ic.parity),
+		Overrun:    uint32(ic.overrun),
+		BufOverrun: uint32(ic.bufOverrun),
+		Break:      uint32(ic.brk),
+		CTS:        uint32(ic.cts),
+		DSR:        uint32(ic.dsr),
+		RI:         uint32(ic.rng),
+		DCD:        uint32(ic.dcd),
+	}
 }
 
 func (s *serialPort) SetTermios(t unix.Termios) error {
@@ -435,12 +1120,16 @@ func (s *serialPort) SetTermios(t unix.Termios) error {
 	if !s.opened {
 		return ErrNotOpen
 	}
+	return s.setTermios(t)
+}
 
+// setTermios applies the Termios under the Lock
+func (s *serialPort) setTermios(t unix.Termios) error {
 	// Set Value
 	if _, _, e1 := unix.Syscall6(
 		unix.SYS_IOCTL,
 		uintptr(s.fd),
-		uintptr(unix.TCSETS),
+		uintptr(ioctlSetTermios),
 		uintptr(unsafe.Pointer(&t)),
 		0,
 		0,
@@ -448,6 +1137,16 @@ func (s *serialPort) SetTermios(t unix.Termios) error {
 	); e1 != 0 {
 		return error(e1)
 	}
+
+	// Counters from here on tell the kind of the marked Errors
+	marked := t.Iflag&unix.PARMRK != 0
+	if marked && !s.marked {
+		s.count, s.countOK = Counters{}, false
+		if c, err := s.counters(); err == nil {
+			s.count, s.countOK = c, true
+		}
+	}
+	s.marked = marked
 	return nil
 }
 
@@ -460,12 +1159,16 @@ func (s *serialPort) GetTermios() (t unix.Termios, err error) {
 	if !s.opened {
 		return t, ErrNotOpen
 	}
+	return s.getTermios()
+}
 
-	// Set Value
+// getTermios reads the Termios under the Lock
+func (s *serialPort) getTermios() (t unix.Termios, err error) {
+	// Get Value
 	if _, _, e1 := unix.Syscall6(
 		unix.SYS_IOCTL,
 		uintptr(s.fd),
-		uintptr(unix.TCGETS),
+		uintptr(ioctlGetTermios),
 		uintptr(unsafe.Pointer(&t)),
 		0,
 		0,
@@ -521,6 +1224,122 @@ func (s *serialPort) SetModemSignal(status int) (err error) {
 	return nil
 }
 
+func (s *serialPort) SetSignals(set, clear ModemSignal) (err error) {
+	defer s.wrapError("set signals", &err)
+
+	if err := checkSignals(set, clear); err != nil {
+		return err
+	}
+	return s.setSignals(set, clear)
+}
+
+func (s *serialPort) PulseSignals(ctx context.Context, steps []SignalStep) (err error) {
+	defer s.wrapError("pulse signals", &err)
+	return pulseSignals(ctx, steps, s.setSignals)
+}
+
+// setSignals activates and deactivates the output lines, each using a
+// single TIOCMBIS / TIOCMBIC so that the other lines are not disturbed
+func (s *serialPort) setSignals(set, clear ModemSignal) error {
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	// Check If its Open
+	if !s.opened {
+		return ErrNotOpen
+	}
+
+	// Signal Inversion
+	if s.sigInv {
+		set, clear = clear, set
+	}
+
+	bits := func(m ModemSignal) int {
+		b := 0
+		if m&ModemRTS != 0 {
+			b |= unix.TIOCM_RTS
+		}
+		if m&ModemDTR != 0 {
+			b |= unix.TIOCM_DTR
+		}
+		return b
+	}
+	if b := bits(set); b != 0 {
+		if err := unix.IoctlSetPointerInt(s.fd, unix.TIOCMBIS, b); err != nil {
+			return err
+		}
+	}
+	if b := bits(clear); b != 0 {
+		if err := unix.IoctlSetPointerInt(s.fd, unix.TIOCMBIC, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Longest wait between the checks of the Output queue during Drain
+const drainPollMax = 50 * time.Millisecond
+
+// Characters the Transmitter is waited for to be empty after the Output
+// queue, for the UART FIFO
+const temtWaitChars = 64
+
+// Deadline in the past used to abort pending I/O on the Runtime Poller
+var aLongTimeAgo = time.Unix(1, 0)
+
+// ioContext runs the I/O operation till the deadline, the Context deadline
+// is used if its earlier and the Context cancellation aborts the operation
+// by moving the deadline in to the past
+func ioContext(ctx context.Context, setDeadline func(time.Time) error,
+	deadline time.Time, op func() (int, error)) (int, error) {
+	// Check if already Cancelled
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// Earliest of the Deadlines
+	ctxDeadline := false
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+		ctxDeadline = true
+	}
+	if err := setDeadline(deadline); err != nil {
+		return 0, err
+	}
+	defer setDeadline(time.Time{})
+
+	// Watch for Cancellation
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		exited := make(chan struct{})
+		go func() {
+			defer close(exited)
+			select {
+			case <-done:
+				setDeadline(aLongTimeAgo)
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-exited
+		}()
+	}
+
+	// Perform the Operation
+	n, err := op()
+	if err != nil {
+		if cerr := ctx.Err(); cerr != nil {
+			err = cerr
+		} else if ctxDeadline && os.IsTimeout(err) {
+			// Poller can expire just ahead of the Context timer
+			err = context.DeadlineExceeded
+		}
+	}
+	return n, err
+}
+
 func linuxFindBaud(baud int) (int, error) {
 	// if baud < 0 || baud == 0 {
 	// 	return unix.B9600, nil
@@ -577,27 +1396,135 @@ func linuxFindBaud(baud int) (int, error) {
 	case 4000000:
 		baudRate = unix.B4000000
 	default:
-		baudRate = 0 // TODO: Indicate we might Have Custom Baud Rate
 		return 0, fmt.Errorf("error incorrect baudrate or not supported")
 	}
 	return baudRate, nil
 }
 
+// setTermiosBaud applies the baud rate to the Termios, standard rates use
+// the Bxxx constants and all other rates fall back to BOTHER with the
+// explicit Input and Output speeds
+func setTermiosBaud(t *unix.Termios, baud int) error {
+	if baud <= 0 {
+		return fmt.Errorf("error incorrect baudrate or not supported")
+	}
+	// Clear the Previous Baud rate
+	t.Cflag &^= unix.CBAUD | unix.CBAUDEX
+	// Check for Standard Baud rate
+	baudSet, err := linuxFindBaud(baud)
+	if err != nil {
+		// Custom Baud rate
+		baudSet = unix.BOTHER
+	}
+	t.Cflag |= uint32(baudSet)
+	t.Ispeed = uint32(baud)
+	t.Ospeed = uint32(baud)
+	return nil
+}
+
+// setTermiosDataBits applies the character size to the Termios, Zero
+// selects the default DataSize
+func setTermiosDataBits(t *unix.Termios, bits byte) error {
+	t.Cflag &^= unix.CSIZE
+	switch dataBitsOf(bits) {
+	case DataBits5:
+		t.Cflag |= unix.CS5
+	case DataBits6:
+		t.Cflag |= unix.CS6
+	case DataBits7:
+		t.Cflag |= unix.CS7
+	case DataBits8:
+		t.Cflag |= unix.CS8
+	default:
+		return fmt.Errorf("invalid or not supported data bits")
+	}
+	return nil
+}
+
+// configFromTermios reads back the Settings of the Termios in to the Config
+func configFromTermios(cfg *Config, t *unix.Termios) {
+	// Driver reports the Actual Output speed in use
+	cfg.Baud = int(t.Ospeed)
+
+	// Data Bits
+	switch t.Cflag & unix.CSIZE {
+	case unix.CS5:
+		cfg.DataBits = DataBits5
+	case unix.CS6:
+		cfg.DataBits = DataBits6
+	case unix.CS7:
+		cfg.DataBits = DataBits7
+	default:
+		cfg.DataBits = DataBits8
+	}
+
+	// Parity
+	cfg.Parity = ParityNone
+	if t.Cflag&unix.PARENB != 0 {
+		odd := t.Cflag&unix.PARODD != 0
+		switch {
+		case t.Cflag&unix.CMSPAR != 0 && odd:
+			cfg.Parity = ParityMark
+		case t.Cflag&unix.CMSPAR != 0:
+			cfg.Parity = ParitySpace
+		case odd:
+			cfg.Parity = ParityOdd
+		default:
+			cfg.Parity = ParityEven
+		}
+	}
+
+	// Stop Bits
+	cfg.StopBits = StopBits1
+	if t.Cflag&unix.CSTOPB != 0 {
+		cfg.StopBits = StopBits2
+	}
+
+	// Carrier Detect
+	cfg.Carrier = t.Cflag&unix.CLOCAL == 0
+
+	// Marked Errors or only the Breaks
+	cfg.MarkErrors = t.Iflag&unix.PARMRK != 0 && t.Iflag&unix.INPCK != 0
+	cfg.MarkBreaks = t.Iflag&unix.PARMRK != 0 && t.Iflag&unix.INPCK == 0
+
+	// Flow Control
+	cfg.Flow = FlowNone
+	if t.Cflag&unix.CRTSCTS != 0 {
+		cfg.Flow = FlowHardware
+	} else if t.Iflag&(unix.IXON|unix.IXOFF) != 0 {
+		cfg.Flow = FlowSoft
+	}
+}
+
 func getTermiosFor(cfg *Config) (unix.Termios, error) {
 	var t unix.Termios
-	// Set the Base RAW Mode - default 8 Bits
-	t.Cflag = unix.CREAD | unix.CLOCAL | unix.CS8
+	// Set the Base RAW Mode
+	t.Cflag = unix.CREAD | unix.CLOCAL
+	// Honour the Carrier Detect and Hang up on Close
+	if cfg.Carrier {
+		t.Cflag &^= unix.CLOCAL
+		t.Cflag |= unix.HUPCL
+	}
 	t.Iflag = unix.IGNPAR
+	// Keep the bytes with Errors and the Breaks marked with 0xFF 0x00
+	if cfg.MarkErrors {
+		t.Iflag &^= unix.IGNPAR
+		t.Iflag |= unix.PARMRK | unix.INPCK
+	} else if cfg.MarkBreaks {
+		t.Iflag |= unix.PARMRK
+	}
 	t.Cc[unix.VMIN] = 0
 	t.Cc[unix.VTIME] = 0
 	// Set Baud Rate
-	baud, err := linuxFindBaud(cfg.Baud)
+	err := setTermiosBaud(&t, cfg.Baud)
+	if err != nil {
+		return unix.Termios{}, err
+	}
+	// Set Data Bits
+	err = setTermiosDataBits(&t, cfg.DataBits)
 	if err != nil {
 		return unix.Termios{}, err
 	}
-	t.Cflag |= uint32(baud)
-	t.Ispeed = uint32(baud)
-	t.Ospeed = uint32(baud)
 	// Set Parity
 	t.Cflag &^= unix.PARENB | unix.PARODD | unix.CMSPAR
 	switch cfg.Parity {
@@ -637,27 +1564,10 @@ func getTermiosFor(cfg *Config) (unix.Termios, error) {
 		return unix.Termios{}, fmt.Errorf("invalid or not supported flow control")
 	}
 	// Timeout Settings
-	// Convert Time Out to Deci Seconds (1/10 of a Seconds)
-	var deciSecTimeout int64 = 0
-	// Minmum Number of Bytes
-	var minBytes uint8 = 1
-	// We have been supplied some timeout
-	if cfg.ReadTimeout > 0 {
-		// Get For Blocking on Timeout
-		deciSecTimeout = cfg.ReadTimeout.Nanoseconds() / 1e8
-		// No Need for Byte Blocking - hence EOF on Zero Read
-		minBytes = 0
-		if deciSecTimeout < 1 { // For Less than 100 mS
-			// min possible timeout 1 Deciseconds (0.1s)
-			deciSecTimeout = 1
-		} else if deciSecTimeout > 255 {
-			// max possible timeout is 255 deciseconds (25.5s)
-			deciSecTimeout = 255
-		}
-	}
-	// Set the Values
-	t.Cc[unix.VMIN] = uint8(minBytes)
-	t.Cc[unix.VTIME] = uint8(deciSecTimeout)
+	// Read Timeout and Deadlines are handled by the Runtime Poller with
+	// nanosecond precision, hence no VTIME clamping to deciseconds
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
 	// We are done
 	return t, nil
 }
@@ -0,0 +1,143 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default Roots of the sysfs and the Device nodes
+const (
+	sysfsRoot = "/sys"
+	devRoot   = "/dev"
+)
+
+// Platform Specific Port Enumeration Function
+func listPorts() ([]PortInfo, error) {
+	return listPortsIn(sysfsRoot, devRoot)
+}
+
+// listPortsIn walks the tty class of the sysfs under the given root, Ports
+// without a backing device (virtual consoles, pty) and serial8250
+// placeholders without an UART are skipped
+func listPortsIn(sysRoot, dRoot string) ([]PortInfo, error) {
+	classDir := filepath.Join(sysRoot, "class", "tty")
+	entries, err := ioutil.ReadDir(classDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Links that identify the Ports
+	links := byIDLinks(dRoot)
+
+	ports := []PortInfo{}
+	for _, e := range entries {
+		info, ok := portInfoFor(sysRoot, dRoot, e.Name())
+		if !ok {
+			continue
+		}
+		info.Links = links[info.Name]
+		ports = append(ports, info)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Name < ports[j].Name
+	})
+	return ports, nil
+}
+
+// portInfoFor collects the details of a single tty from the sysfs
+func portInfoFor(sysRoot, dRoot, name string) (PortInfo, bool) {
+	ttyDir := filepath.Join(sysRoot, "class", "tty", name)
+
+	// Virtual terminals have no device
+	devDir, err := filepath.EvalSymlinks(filepath.Join(ttyDir, "device"))
+	if err != nil {
+		return PortInfo{}, false
+	}
+
+	info := PortInfo{
+		Name:      name,
+		Device:    filepath.Join(dRoot, name),
+		Driver:    linkBase(filepath.Join(devDir, "driver")),
+		Interface: -1,
+	}
+
+	// Placeholder serial8250 Ports report an unknown UART type
+	if t, ok := readSysfs(ttyDir, "type"); ok && t == "0" {
+		return PortInfo{}, false
+	}
+
+	// Walk up to the USB device if any
+	stop := filepath.Clean(sysRoot)
+	for dir := devDir; dir != stop && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if info.Interface < 0 {
+			if v, ok := readSysfs(dir, "bInterfaceNumber"); ok {
+				if n, err := strconv.ParseInt(v, 16, 32); err == nil {
+					info.Interface = int(n)
+				}
+			}
+		}
+		vid, ok := readSysfs(dir, "idVendor")
+		if !ok {
+			continue
+		}
+		pid, _ := readSysfs(dir, "idProduct")
+		v, _ := strconv.ParseUint(vid, 16, 16)
+		p, _ := strconv.ParseUint(pid, 16, 16)
+		info.IsUSB = true
+		info.VID = uint16(v)
+		info.PID = uint16(p)
+		info.SerialNumber, _ = readSysfs(dir, "serial")
+		info.Manufacturer, _ = readSysfs(dir, "manufacturer")
+		info.Product, _ = readSysfs(dir, "product")
+		break
+	}
+	return info, true
+}
+
+// byIDLinks maps the tty names to the persistent links in /dev/serial/by-id
+func byIDLinks(dRoot string) map[string][]string {
+	links := map[string][]string{}
+	dir := filepath.Join(dRoot, "serial", "by-id")
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return links
+	}
+	for _, e := range entries {
+		link := filepath.Join(dir, e.Name())
+		target := linkBase(link)
+		if target == "" {
+			continue
+		}
+		links[target] = append(links[target], link)
+	}
+	return links
+}
+
+// linkBase provides the last element of the Symbolic link target
+func linkBase(path string) string {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// readSysfs reads a single value attribute
+func readSysfs(dir, attr string) (string, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, attr))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(b)), true
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Fake sysfs and /dev builder
+type fakeSys struct {
+	t    *testing.T
+	root string
+}
+
+func newFakeSys(t *testing.T) *fakeSys {
+	root, err := ioutil.TempDir("", "serial-sysfs")
+	if err != nil {
+		t.Errorf("Error in Creating Directory - %v", err)
+		t.FailNow()
+	}
+	f := &fakeSys{t: t, root: root}
+	f.mkdir("sys/class/tty")
+	f.mkdir("dev/serial/by-id")
+	return f
+}
+
+func (f *fakeSys) sys() string { return filepath.Join(f.root, "sys") }
+func (f *fakeSys) dev() string { return filepath.Join(f.root, "dev") }
+
+func (f *fakeSys) mkdir(dir string) string {
+	p := filepath.Join(f.root, dir)
+	if err := os.MkdirAll(p, 0755); err != nil {
+		f.t.Errorf("Error in Creating Directory - %v", err)
+		f.t.FailNow()
+	}
+	return p
+}
+
+func (f *fakeSys) write(dir string, attrs map[string]string) {
+	p := f.mkdir(dir)
+	for k, v := range attrs {
+		err := ioutil.WriteFile(filepath.Join(p, k), []byte(v+"\n"), 0644)
+		if err != nil {
+			f.t.Errorf("Error in Writing Attribute - %v", err)
+			f.t.FailNow()
+		}
+	}
+}
+
+func (f *fakeSys) link(target, link string) {
+	p := filepath.Join(f.root, link)
+	f.mkdir(filepath.Dir(link))
+	if err := os.Symlink(filepath.Join(f.root, target), p); err != nil {
+		f.t.Errorf("Error in Creating Link - %v", err)
+		f.t.FailNow()
+	}
+}
+
+// Class entry of a tty with the device and its driver
+func (f *fakeSys) tty(name, devDir, driver string, attrs map[string]string) {
+	f.write(filepath.Join(devDir, "tty", name), attrs)
+	f.link(filepath.Join(devDir, "tty", name), filepath.Join("sys/class/tty", name))
+	if devDir != "" {
+		f.link(devDir, filepath.Join(devDir, "tty", name, "device"))
+		f.link(filepath.Join("sys/bus/drivers", driver), filepath.Join(devDir, "driver"))
+	}
+}
+
+func TestListPortsIn(t *testing.T) {
+
+	f := newFakeSys(t)
+	defer os.RemoveAll(f.root)
+
+	// FTDI USB to UART
+	usb := "sys/devices/pci0000:00/usb1/1-1"
+	f.write(usb, map[string]string{
+		"idVendor":     "0403",
+		"idProduct":    "6001",
+		"serial":       "A50285BI",
+		"manufacturer": "FTDI",
+		"product":      "FT232R USB UART",
+	})
+	f.write(usb+"/1-1:1.0", map[string]string{"bInterfaceNumber": "00"})
+	f.tty("ttyUSB0", usb+"/1-1:1.0/ttyUSB0", "ftdi_sio", nil)
+	f.link("dev/ttyUSB0", "dev/serial/by-id/usb-FTDI_FT232R_USB_UART_A50285BI-if00-port0")
+
+	// CDC ACM on the Second Interface
+	acm := "sys/devices/pci0000:00/usb1/1-2"
+	f.write(acm, map[string]string{
+		"idVendor":  "2341",
+		"idProduct": "0043",
+	})
+	f.write(acm+"/1-2:1.2", map[string]string{"bInterfaceNumber": "02"})
+	f.tty("ttyACM0", acm+"/1-2:1.2", "cdc_acm", nil)
+
+	// On board UART and a Placeholder without UART
+	f.tty("ttyS0", "sys/devices/platform/serial8250/00:00:0.0", "serial8250",
+		map[string]string{"type": "4"})
+	f.tty("ttyS1", "sys/devices/platform/serial8250/00:00:0.1", "serial8250",
+		map[string]string{"type": "0"})
+
+	// Virtual Terminal
+	f.tty("tty0", "", "", nil)
+
+	got, err := listPortsIn(f.sys(), f.dev())
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+
+	want := []PortInfo{
+		{
+			Name:      "ttyACM0",
+			Device:    filepath.Join(f.dev(), "ttyACM0"),
+			Driver:    "cdc_acm",
+			IsUSB:     true,
+			VID:       0x2341,
+			PID:       0x0043,
+			Interface: 2,
+		},
+		{
+			Name:      "ttyS0",
+			Device:    filepath.Join(f.dev(), "ttyS0"),
+			Driver:    "serial8250",
+			Interface: -1,
+		},
+		{
+			Name:         "ttyUSB0",
+			Device:       filepath.Join(f.dev(), "ttyUSB0"),
+			Driver:       "ftdi_sio",
+			IsUSB:        true,
+			VID:          0x0403,
+			PID:          0x6001,
+			SerialNumber: "A50285BI",
+			Manufacturer: "FTDI",
+			Product:      "FT232R USB UART",
+			Interface:    0,
+			Links: []string{
+				filepath.Join(f.dev(), "serial/by-id/usb-FTDI_FT232R_USB_UART_A50285BI-if00-port0"),
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listPortsIn() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestListPortsMissingRoot(t *testing.T) {
+	_, err := listPortsIn("/nonexistent/sys", "/nonexistent/dev")
+	if err == nil {
+		t.Errorf("Expected Error but got NIL")
+	}
+}
+
+func TestListPorts(t *testing.T) {
+	ports, err := ListPorts()
+	if err != nil {
+		t.Skipf("sysfs not available - %v", err)
+	}
+	for _, p := range ports {
+		t.Logf("Info - %+v", p)
+	}
+}
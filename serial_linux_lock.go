@@ -0,0 +1,169 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultLockDir is the Directory used for UUCP style lock files when
+// Config.LockDir is not specified
+const DefaultLockDir = "/var/lock"
+
+// Path of the Kernel list of File locks
+var procLocks = "/proc/locks"
+
+// lockFileName provides the UUCP style lock file name for the Port,
+// e.g. "/dev/ttyUSB0" becomes "LCK..ttyUSB0" and "/dev/pts/3" "LCK..pts_3"
+func lockFileName(dir, name string) string {
+	if dir == "" {
+		dir = DefaultLockDir
+	}
+	dev := strings.TrimPrefix(filepath.Clean(name), "/dev/")
+	dev = strings.ReplaceAll(strings.TrimPrefix(dev, "/"), "/", "_")
+	return filepath.Join(dir, "LCK.."+dev)
+}
+
+// readLockPID provides the PID stored in a UUCP style lock file, both the
+// ASCII and the older 4 byte binary formats are understood
+func readLockPID(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+		return pid, nil
+	}
+	if len(b) == 4 {
+		return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24, nil
+	}
+	return 0, fmt.Errorf("invalid lock file %q", path)
+}
+
+// isProcessAlive checks if the PID belongs to a running process
+func isProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := unix.Kill(pid, 0)
+	return err == nil || err == unix.EPERM
+}
+
+// acquireLockFile creates the UUCP style lock file for the Port, a lock file
+// left behind by a process that no longer runs is removed as stale
+func acquireLockFile(path string) error {
+	content := []byte(fmt.Sprintf("%10d\n", os.Getpid()))
+	for retry := 0; retry < 2; retry++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(content)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+			}
+			return err
+		}
+		if os.IsPermission(err) {
+			return fmt.Errorf("%w - can't create lock file %q", ErrAccessDenied, path)
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		// Check the Owner of the existing Lock
+		pid, perr := readLockPID(path)
+		if perr == nil && isProcessAlive(pid) {
+			return fmt.Errorf("%w - locked by pid %d", ErrAlreadyOpen, pid)
+		}
+		// Stale Lock
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w - can't create lock file %q", ErrAlreadyOpen, path)
+}
+
+// flockOwner finds the PID holding the flock on the file from the Kernel
+// list of locks, Zero if not known
+func flockOwner(fd int) int {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return 0
+	}
+	return lockOwner(&st)
+}
+
+// pathOwner finds the PID holding the flock on the file at the path, Zero
+// if not known
+func pathOwner(name string) int {
+	var st unix.Stat_t
+	if err := unix.Stat(name, &st); err != nil {
+		return 0
+	}
+	return lockOwner(&st)
+}
+
+// lockOwner finds the PID holding the flock on the file of the Stat from
+// the Kernel list of locks, Zero if not known
+func lockOwner(st *unix.Stat_t) int {
+	f, err := os.Open(procLocks)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	// Format: "1: FLOCK  ADVISORY  WRITE 1234 00:05:1036 0 EOF"
+	dev := fmt.Sprintf("%02x:%02x:%d",
+		unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)), st.Ino)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] != "FLOCK" || fields[5] != dev {
+			continue
+		}
+		if pid, err := strconv.Atoi(fields[4]); err == nil {
+			return pid
+		}
+	}
+	return 0
+}
+
+// lockPort takes the exclusive flock on the Port
+func lockPort(fd int) error {
+	err := unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB)
+	if err == unix.EWOULDBLOCK {
+		if pid := flockOwner(fd); pid != 0 {
+			return fmt.Errorf("%w - locked by pid %d", ErrAlreadyOpen, pid)
+		}
+		return ErrAlreadyOpen
+	}
+	return err
+}
+
+// openBusy checks the Error of the open for a Port held by a Cooperating
+// process, TIOCEXCL of the first opener fails the open of the others with
+// EBUSY before the flock can be tried (except for root)
+func openBusy(name string, err error) error {
+	if err != unix.EBUSY {
+		return err
+	}
+	if pid := pathOwner(name); pid != 0 {
+		return fmt.Errorf("%w - locked by pid %d", ErrAlreadyOpen, pid)
+	}
+	return err
+}
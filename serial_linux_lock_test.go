@@ -0,0 +1,184 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestLockFileName(t *testing.T) {
+	tests := []struct {
+		dir  string
+		name string
+		want string
+	}{
+		{"", "/dev/ttyUSB0", "/var/lock/LCK..ttyUSB0"},
+		{"/tmp", "/dev/ttyS1", "/tmp/LCK..ttyS1"},
+		{"/tmp", "/dev/pts/3", "/tmp/LCK..pts_3"},
+		{"/tmp", "ttyACM0", "/tmp/LCK..ttyACM0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lockFileName(tt.dir, tt.name); got != tt.want {
+				t.Errorf("lockFileName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcquireLockFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "serial-lock")
+	if err != nil {
+		t.Errorf("Error in Creating Directory - %v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	lock := filepath.Join(dir, "LCK..ttyUSB0")
+
+	// Fresh Lock
+	err = acquireLockFile(lock)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+	pid, err := readLockPID(lock)
+	if err != nil || pid != os.Getpid() {
+		t.Errorf("Expected PID %d but got %d with %v", os.Getpid(), pid, err)
+	}
+
+	// Held by a Running process
+	err = acquireLockFile(lock)
+	if !errors.Is(err, ErrAlreadyOpen) {
+		t.Errorf("Expected %v but got %v", ErrAlreadyOpen, err)
+	}
+	if err != nil && !strings.Contains(err.Error(), fmt.Sprint(os.Getpid())) {
+		t.Errorf("Expected PID in the Error but got %v", err)
+	}
+
+	// Stale Lock of a process that does not exist
+	err = ioutil.WriteFile(lock, []byte(fmt.Sprintf("%10d\n", 1<<22+1)), 0644)
+	if err != nil {
+		t.Errorf("Error in Writing Lock - %v", err)
+		t.FailNow()
+	}
+	err = acquireLockFile(lock)
+	if err != nil {
+		t.Errorf("Expected Stale Lock to be Replaced but got %v", err)
+	}
+
+	// Binary Lock format
+	err = ioutil.WriteFile(lock, []byte{0x39, 0x30, 0, 0}, 0644)
+	if err != nil {
+		t.Errorf("Error in Writing Lock - %v", err)
+		t.FailNow()
+	}
+	pid, err = readLockPID(lock)
+	if err != nil || pid != 12345 {
+		t.Errorf("Expected PID 12345 but got %d with %v", pid, err)
+	}
+}
+
+func TestOpenLocked(t *testing.T) {
+
+	master, slave := openPty(t)
+	defer unix.Close(master)
+
+	dir, err := ioutil.TempDir("", "serial-lock")
+	if err != nil {
+		t.Errorf("Error in Creating Directory - %v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Config{Name: slave, Baud: 9600, LockFile: true, LockDir: dir}
+	ref, err := OpenPort(c)
+	if err != nil {
+		t.Errorf("Error in Opening Port - %v", err)
+		t.FailNow()
+	}
+	lock := lockFileName(dir, slave)
+	if _, err := os.Stat(lock); err != nil {
+		t.Errorf("Expected Lock file %q - %v", lock, err)
+	}
+
+	// Lock file stops a Second Open
+	_, err = OpenPort(c)
+	if !errors.Is(err, ErrAlreadyOpen) {
+		t.Errorf("Expected %v but got %v", ErrAlreadyOpen, err)
+	}
+
+	// flock stops a Second Open even without the Lock file
+	_, err = OpenPort(&Config{Name: slave, Baud: 9600})
+	if !errors.Is(err, ErrAlreadyOpen) {
+		t.Errorf("Expected %v but got %v", ErrAlreadyOpen, err)
+	}
+	if err != nil && !strings.Contains(err.Error(), fmt.Sprint(os.Getpid())) {
+		t.Logf("Info - Owner PID not known - %v", err)
+	}
+
+	// Close releases both the Locks
+	err = ref.Close()
+	if err != nil {
+		t.Errorf("Error in Closing Port - %v", err)
+	}
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Errorf("Expected Lock file to be Removed - %v", err)
+	}
+	ref, err = OpenPort(c)
+	if err != nil {
+		t.Errorf("Error in Re-Opening Port - %v", err)
+		t.FailNow()
+	}
+	ref.Close()
+}
+
+func TestOpenBusy(t *testing.T) {
+
+	f, err := ioutil.TempFile("", "serial-busy")
+	if err != nil {
+		t.Errorf("Error in Creating File - %v", err)
+		t.FailNow()
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// Port held exclusively by a process without the flock
+	err = openBusy(f.Name(), unix.EBUSY)
+	if err != unix.EBUSY {
+		t.Errorf("Expected %v but got %v", unix.EBUSY, err)
+	}
+
+	// Cooperating process found by its flock
+	err = unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err != nil {
+		t.Errorf("Error in Locking - %v", err)
+		t.FailNow()
+	}
+	err = openBusy(f.Name(), unix.EBUSY)
+	if !errors.Is(err, ErrAlreadyOpen) {
+		t.Errorf("Expected %v but got %v", ErrAlreadyOpen, err)
+	}
+	if err != nil && !strings.Contains(err.Error(), fmt.Sprint(os.Getpid())) {
+		t.Errorf("Expected PID in the Error but got %v", err)
+	}
+
+	// Other Errors are kept
+	err = openBusy(f.Name(), unix.ENOENT)
+	if err != unix.ENOENT {
+		t.Errorf("Expected %v but got %v", unix.ENOENT, err)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"context"
+	"fmt"
+)
+
+// States of the Decoder in the PARMRK escapes
+const (
+	markData    = iota // Data bytes
+	markEscape         // After 0xFF
+	markErrored        // After 0xFF 0x00
+)
+
+// markDecoder removes the PARMRK escapes from the received data, the kernel
+// sends 0xFF 0xFF for a 0xFF data byte, 0xFF 0x00 X for a byte X with a
+// Parity or Framing error and 0xFF 0x00 0x00 for a Break. Escapes split
+// across the Reads are carried over, as are the bytes that don't fit.
+type markDecoder struct {
+	state   int
+	pending []markedByte // Decoded bytes provided before the next data
+}
+
+// markedByte is a decoded byte with its Errors
+type markedByte struct {
+	b byte
+	e LineError
+}
+
+// room provides how many raw bytes to Read for a buffer of the size, the
+// pending bytes and an Escape carried over take up a byte each. Zero
+// means the pending bytes fill the buffer.
+func (d *markDecoder) room(size int) int {
+	size -= len(d.pending)
+	if d.state == markEscape && size > 1 {
+		size--
+	}
+	if size < 0 {
+		return 0
+	}
+	return size
+}
+
+// decode converts the raw data into p along with the Errors of each byte
+// in errs unless its nil, it provides the number of bytes and how many of
+// them have Parity or Framing errors. Bytes beyond the length of p are
+// kept pending for the next call.
+func (d *markDecoder) decode(raw, p []byte, errs []LineError) (n, flagged int) {
+	put := func(b byte, e LineError) {
+		if n == len(p) {
+			d.pending = append(d.pending, markedByte{b, e})
+			return
+		}
+		p[n] = b
+		if errs != nil {
+			errs[n] = e
+		}
+		if e == LineParity|LineFraming {
+			flagged++
+		}
+		n++
+	}
+
+	// Bytes left over from the last call
+	pending := d.pending
+	d.pending = nil
+	for _, m := range pending {
+		put(m.b, m.e)
+	}
+
+	for _, b := range raw {
+		switch d.state {
+		case markEscape:
+			switch b {
+			case 0xFF:
+				put(0xFF, 0)
+				d.state = markData
+			case 0x00:
+				d.state = markErrored
+			default:
+				// Not an Escape, keep the bytes as received
+				put(0xFF, 0)
+				put(b, 0)
+				d.state = markData
+			}
+		case markErrored:
+			if b == 0x00 {
+				put(0x00, LineBreak)
+			} else {
+				put(b, LineParity|LineFraming)
+			}
+			d.state = markData
+		default:
+			if b == 0xFF {
+				d.state = markEscape
+				continue
+			}
+			put(b, 0)
+		}
+	}
+	return n, flagged
+}
+
+// markMode checks if the Errors are marked in the received data
+func (s *serialPort) markMode() bool {
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.marked
+}
+
+// classify tells the Parity errors from the Framing errors using the change
+// of the driver Counters, both stay flagged when that is not possible
+func (s *serialPort) classify(errs []LineError) {
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if !s.opened {
+		return
+	}
+	c, err := s.counters()
+	if err != nil {
+		s.countOK = false
+		return
+	}
+	prev, ok := s.count, s.countOK
+	s.count, s.countOK = c, true
+	if !ok {
+		return
+	}
+
+	// Only one kind of Error happened
+	d := c.Sub(prev)
+	kind := LineParity | LineFraming
+	switch {
+	case d.Parity > 0 && d.Frame == 0:
+		kind = LineParity
+	case d.Frame > 0 && d.Parity == 0:
+		kind = LineFraming
+	default:
+		return
+	}
+	for i, e := range errs {
+		if e == LineParity|LineFraming {
+			errs[i] = kind
+		}
+	}
+}
+
+func (s *serialPort) ReadMarked(ctx context.Context, p []byte, errs []LineError) (n int, err error) {
+	defer s.wrapError("read marked", &err)
+
+	if len(errs) < len(p) {
+		return 0, fmt.Errorf("errors buffer shorter than the data buffer")
+	}
+
+	// Only one Reader at a time
+	s.rl.Lock()
+	defer s.rl.Unlock()
+
+	return s.read(ctx, p, errs[:len(p)], 0)
+}
@@ -0,0 +1,253 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestMarkDecoder(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    [][]byte
+		data   []byte
+		errs   []LineError
+		marked int
+	}{
+		{
+			name: "Plain",
+			raw:  [][]byte{{'A', 'B', 0x00}},
+			data: []byte{'A', 'B', 0x00},
+			errs: []LineError{0, 0, 0},
+		},
+		{
+			name: "Data 0xFF",
+			raw:  [][]byte{{0xFF, 0xFF, 'A', 0xFF, 0xFF}},
+			data: []byte{0xFF, 'A', 0xFF},
+			errs: []LineError{0, 0, 0},
+		},
+		{
+			name:   "Error and Break",
+			raw:    [][]byte{{'A', 0xFF, 0x00, 'B', 0xFF, 0x00, 0x00, 'C'}},
+			data:   []byte{'A', 'B', 0x00, 'C'},
+			errs:   []LineError{0, LineParity | LineFraming, LineBreak, 0},
+			marked: 1,
+		},
+		{
+			name:   "Errored 0xFF",
+			raw:    [][]byte{{0xFF, 0x00, 0xFF}},
+			data:   []byte{0xFF},
+			errs:   []LineError{LineParity | LineFraming},
+			marked: 1,
+		},
+		{
+			name:   "Split Escapes",
+			raw:    [][]byte{{'A', 0xFF}, {0xFF, 0xFF}, {0x00}, {'B', 0xFF}, {0x00, 0x00}},
+			data:   []byte{'A', 0xFF, 'B', 0x00},
+			errs:   []LineError{0, 0, LineParity | LineFraming, LineBreak},
+			marked: 1,
+		},
+		{
+			// Bare 0xFF received before the marking was enabled
+			name: "Carried Escape",
+			raw:  [][]byte{{'A', 0xFF}, []byte("BCD")},
+			data: []byte{'A', 0xFF, 'B', 'C', 'D'},
+			errs: []LineError{0, 0, 0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d markDecoder
+			var data []byte
+			var errs []LineError
+			marked := 0
+			for _, raw := range tt.raw {
+				p := make([]byte, len(raw))
+				e := make([]LineError, len(raw))
+				n, m := d.decode(raw, p, e)
+				data = append(data, p[:n]...)
+				errs = append(errs, e[:n]...)
+				marked += m
+			}
+			// Bytes that did not fit
+			for len(d.pending) > 0 {
+				p := make([]byte, 1)
+				e := make([]LineError, 1)
+				n, m := d.decode(nil, p, e)
+				data = append(data, p[:n]...)
+				errs = append(errs, e[:n]...)
+				marked += m
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Errorf("Expected % X but got % X", tt.data, data)
+			}
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("Expected %v but got %v", tt.errs, errs)
+			}
+			for i := range errs {
+				if errs[i] != tt.errs[i] {
+					t.Errorf("Byte %d Expected %v but got %v", i, tt.errs[i], errs[i])
+				}
+			}
+			if marked != tt.marked {
+				t.Errorf("Expected %d Errors but got %d", tt.marked, marked)
+			}
+		})
+	}
+
+	// Escape carried over fills the buffer
+	var d markDecoder
+	p := make([]byte, 4)
+	d.decode([]byte{0xFF}, p, nil)
+	if r := d.room(len(p)); r != 3 {
+		t.Errorf("Expected room for 3 bytes but got %d", r)
+	}
+	n, _ := d.decode([]byte("ABCD"), p, nil)
+	if n != 4 || !bytes.Equal(p, []byte{0xFF, 'A', 'B', 'C'}) {
+		t.Errorf("Expected % X but got % X", []byte{0xFF, 'A', 'B', 'C'}, p[:n])
+	}
+	if r := d.room(len(p)); r != 3 {
+		t.Errorf("Expected room for 3 bytes but got %d", r)
+	}
+	n, _ = d.decode(nil, p, nil)
+	if n != 1 || p[0] != 'D' {
+		t.Errorf("Expected %q but got %q", "D", p[:n])
+	}
+
+	// Without the Errors
+	d = markDecoder{}
+	n, _ = d.decode([]byte{0xFF, 0x00, 'X', 'Y'}, p, nil)
+	if !bytes.Equal(p[:n], []byte("XY")) {
+		t.Errorf("Expected %q but got %q", "XY", p[:n])
+	}
+}
+
+func TestReadMarked(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	err := s.Reconfigure(Config{Baud: 9600, MarkErrors: true})
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+	c, err := s.Config()
+	if err != nil || !c.MarkErrors {
+		t.Errorf("Expected Marked Errors but got %v, %v", &c, err)
+	}
+
+	// The kernel escapes the 0xFF data bytes
+	want := []byte{'A', 0xFF, 0x00, 0xFF, 0xFF, 'B'}
+	_, err = unix.Write(master, want)
+	if err != nil {
+		t.Errorf("Error in Writing - %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	buf := make([]byte, 20)
+	errs := make([]LineError, 20)
+	var got []byte
+	for len(got) < len(want) && ctx.Err() == nil {
+		n, err := s.ReadMarked(ctx, buf, errs)
+		if err != nil {
+			t.Errorf("Expected No Error but got %v instead", err)
+			break
+		}
+		for i := range errs[:n] {
+			if errs[i] != 0 {
+				t.Errorf("Expected No Error for % X but got %v", buf[i], errs[i])
+			}
+		}
+		got = append(got, buf[:n]...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected % X but got % X", want, got)
+	}
+
+	// Escapes split across the Reads provide data on each Read
+	want = []byte{0xFF, 'Z', 0xFF}
+	_, err = unix.Write(master, want)
+	if err != nil {
+		t.Errorf("Error in Writing - %v", err)
+	}
+	for i := range want {
+		n, err := s.ReadMarked(ctx, buf[:1], errs[:1])
+		if err != nil || n != 1 || buf[0] != want[i] {
+			t.Errorf("Expected % X but got % X, %v", want[i], buf[:n], err)
+		}
+	}
+
+	// Errors buffer must cover the Data
+	_, err = s.ReadMarked(ctx, buf, errs[:1])
+	var pe *PortError
+	if !errors.As(err, &pe) || pe.Op != "read marked" {
+		t.Errorf("Expected Port Error but got %v", err)
+	}
+}
+
+func TestSendBreakFor(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	// Breaks received are marked, the Data stays as is
+	err := s.Reconfigure(Config{Baud: 300, MarkBreaks: true})
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+	_, err = unix.Write(master, []byte{0xFF, 'A'})
+	if err != nil {
+		t.Errorf("Error in Writing - %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	buf := make([]byte, 10)
+	errs := make([]LineError, 10)
+	n, err := s.ReadMarked(context.Background(), buf, errs)
+	if err != nil || !bytes.Equal(buf[:n], []byte{0xFF, 'A'}) || errs[0] != 0 {
+		t.Errorf("Expected % X but got % X, %v", []byte{0xFF, 'A'}, buf[:n], err)
+	}
+
+	// Break lasts at least a Character
+	c, _ := s.Config()
+	tests := []struct {
+		d    time.Duration
+		want time.Duration
+	}{
+		{0, c.BreakTime(0)},
+		{50 * time.Millisecond, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		err = s.SendBreakFor(tt.d)
+		took := time.Since(start)
+		if err != nil {
+			t.Errorf("Expected No Error but got %v instead", err)
+		}
+		if took < tt.want || took > tt.want+50*time.Millisecond {
+			t.Errorf("Expected Break of %v but took %v", tt.want, took)
+		}
+	}
+
+	s.Close()
+	err = s.SendBreakFor(time.Millisecond)
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+}
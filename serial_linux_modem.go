@@ -0,0 +1,325 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Interval for Polling the Modem lines when the driver can't wait for
+// their changes
+var modemPollInterval = 10 * time.Millisecond
+
+// Modem input lines and their TIOCM bits
+var modemBits = []struct {
+	sig ModemSignal
+	bit int
+}{
+	{ModemCTS, unix.TIOCM_CTS},
+	{ModemDSR, unix.TIOCM_DSR},
+	{ModemRI, unix.TIOCM_RNG},
+	{ModemDCD, unix.TIOCM_CD},
+}
+
+// modemEvents provides the Events for the lines that differ between the
+// previous and the current Status
+func modemEvents(prev, cur int, invert bool, now time.Time) []ModemEvent {
+	var events []ModemEvent
+	for _, m := range modemBits {
+		if (prev^cur)&m.bit == 0 {
+			continue
+		}
+		rising := cur&m.bit != 0
+		if invert {
+			rising = !rising
+		}
+		events = append(events, ModemEvent{Signal: m.sig, Rising: rising, Time: now})
+	}
+	return events
+}
+
+// modemSub is a Subscriber of the Modem Events
+type modemSub struct {
+	ctx  context.Context
+	mask ModemSignal
+	ch   chan ModemEvent
+}
+
+// modemMonitor waits for the changes of the Modem lines while there are
+// Subscribers, a single wait in the kernel serves all the Subscribers of
+// the Port as TIOCMIWAIT can't be interrupted
+type modemMonitor struct {
+	status func() (int, error) // Read the Modem lines
+	wait   func() error        // Wait for a change of the Modem lines
+	invert func() bool         // Signal Inversion setting
+
+	mx      sync.Mutex
+	subs    map[*modemSub]struct{}
+	running bool
+	stopped bool
+	err     error         // Error that ended the last Monitor
+	done    chan struct{} // Closed on stop
+	once    sync.Once
+}
+
+func newModemMonitor(status func() (int, error), wait func() error,
+	invert func() bool) *modemMonitor {
+	return &modemMonitor{
+		status: status,
+		wait:   wait,
+		invert: invert,
+		subs:   map[*modemSub]struct{}{},
+		done:   make(chan struct{}),
+	}
+}
+
+// subscribe provides the Events of the lines in the mask till the Context
+// is done or the Port is closed
+func (m *modemMonitor) subscribe(ctx context.Context, mask ModemSignal) (<-chan ModemEvent, error) {
+	// Check that the lines can be read
+	status, err := m.status()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.stopped {
+		return nil, ErrNotOpen
+	}
+	sub := &modemSub{ctx: ctx, mask: mask, ch: make(chan ModemEvent, 16)}
+	m.subs[sub] = struct{}{}
+	if !m.running {
+		m.running = true
+		m.err = nil
+		go m.run(status)
+	}
+
+	// Unsubscribe with the Context
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-m.done:
+		}
+		m.remove(sub)
+	}()
+	return sub.ch, nil
+}
+
+// remove closes the Subscription
+func (m *modemMonitor) remove(sub *modemSub) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if _, ok := m.subs[sub]; ok {
+		delete(m.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// closeAll closes all the Subscriptions
+func (m *modemMonitor) closeAll() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	for sub := range m.subs {
+		delete(m.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// stop closes all the Subscriptions when the Port is closed, a wait in
+// progress ends with the next change of the lines (waitModemLines)
+func (m *modemMonitor) stop() {
+	m.once.Do(func() { close(m.done) })
+	m.mx.Lock()
+	m.stopped = true
+	m.mx.Unlock()
+	m.closeAll()
+}
+
+// lastError provides the Error that ended the Subscriptions
+func (m *modemMonitor) lastError() error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.err == nil {
+		return ErrNotOpen
+	}
+	return m.err
+}
+
+// active checks for Subscribers, the Monitor ends without them
+func (m *modemMonitor) active() bool {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if len(m.subs) == 0 || m.stopped {
+		m.running = false
+		return false
+	}
+	return true
+}
+
+// broadcast delivers the Events to the Subscribers of the lines
+func (m *modemMonitor) broadcast(events []ModemEvent) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	for sub := range m.subs {
+		for _, e := range events {
+			if e.Signal&sub.mask == 0 {
+				continue
+			}
+			select {
+			case sub.ch <- e:
+			case <-sub.ctx.Done():
+			case <-m.done:
+				return
+			}
+		}
+	}
+}
+
+// run waits for the changes from the initial Status till there are no
+// more Subscribers, drivers without TIOCMIWAIT support are polled
+func (m *modemMonitor) run(prev int) {
+	poll := false
+	var err error
+	for m.active() {
+		if poll {
+			t := time.NewTimer(modemPollInterval)
+			select {
+			case <-t.C:
+			case <-m.done:
+				t.Stop()
+			}
+		} else if err = m.wait(); err != nil {
+			if !isUnsupported(err) && err != unix.EINTR {
+				break
+			}
+			poll = poll || isUnsupported(err)
+			err = nil
+			continue
+		}
+
+		var cur int
+		cur, err = m.status()
+		if err != nil {
+			break
+		}
+		m.broadcast(modemEvents(prev, cur, m.invert(), time.Now()))
+		prev = cur
+	}
+	if err != nil {
+		// Lines can't be read anymore
+		m.mx.Lock()
+		m.err = err
+		m.running = false
+		m.mx.Unlock()
+		m.closeAll()
+	}
+}
+
+// isUnsupported checks if the Error is due to the driver not supporting
+// the request
+func isUnsupported(err error) bool {
+	return err == unix.ENOTTY || err == unix.EINVAL || err == unix.ENOSYS
+}
+
+// waitModemLines waits in the kernel for a change of the Modem input lines.
+// The wait is on a duplicate of the descriptor taken under the Lock, so
+// that its number is not reused by another File if the Port is closed
+// meanwhile. TIOCMIWAIT can't be interrupted, after Close it ends with the
+// next change of the lines or the removal of the device.
+func (s *serialPort) waitModemLines() error {
+	// Establish Lock
+	s.mx.Lock()
+	// Check If its Open
+	if !s.opened {
+		s.mx.Unlock()
+		return ErrNotOpen
+	}
+	fd, err := unix.FcntlInt(uintptr(s.fd), unix.F_DUPFD_CLOEXEC, 0)
+	s.mx.Unlock()
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	return unix.IoctlSetInt(fd, unix.TIOCMIWAIT,
+		unix.TIOCM_CTS|unix.TIOCM_DSR|unix.TIOCM_RNG|unix.TIOCM_CD)
+}
+
+func (s *serialPort) ModemEvents(ctx context.Context, mask ModemSignal) (events <-chan ModemEvent, err error) {
+	defer s.wrapError("modem events", &err)
+	return s.subscribeModem(ctx, mask)
+}
+
+// subscribeModem provides the Events from the Monitor of the Port
+func (s *serialPort) subscribeModem(ctx context.Context, mask ModemSignal) (<-chan ModemEvent, error) {
+	// Establish Lock
+	s.mx.Lock()
+	m := s.modem
+	opened := s.opened
+	s.mx.Unlock()
+
+	// Check If its Open
+	if !opened || m == nil {
+		return nil, ErrNotOpen
+	}
+	return m.subscribe(ctx, mask)
+}
+
+func (s *serialPort) WaitModemChange(ctx context.Context, mask ModemSignal) (changed ModemSignal, err error) {
+	defer s.wrapError("wait modem change", &err)
+
+	// Check if already Cancelled
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// Subscription till the Change
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := s.subscribeModem(sctx, mask)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case e, ok := <-events:
+		if !ok {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			s.mx.Lock()
+			m := s.modem
+			s.mx.Unlock()
+			if m == nil {
+				return 0, ErrNotOpen
+			}
+			return 0, m.lastError()
+		}
+		changed = e.Signal
+		// Lines that changed at the same time
+		for {
+			select {
+			case next, ok := <-events:
+				if ok && next.Time.Equal(e.Time) {
+					changed |= next.Signal
+					continue
+				}
+			default:
+			}
+			break
+		}
+		return changed, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Modem lines that change on request
+type fakeLines struct {
+	mx     sync.Mutex
+	status int
+	err    error
+	change chan struct{}
+	inv    bool
+}
+
+func newFakeLines() *fakeLines {
+	return &fakeLines{change: make(chan struct{}, 1)}
+}
+
+func (l *fakeLines) get() (int, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.status, l.err
+}
+
+func (l *fakeLines) wait() error {
+	<-l.change
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.err
+}
+
+func (l *fakeLines) invert() bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.inv
+}
+
+func (l *fakeLines) set(status int, err error) {
+	l.mx.Lock()
+	l.status = status
+	l.err = err
+	l.mx.Unlock()
+	l.change <- struct{}{}
+}
+
+func expectEvent(t *testing.T, events <-chan ModemEvent, sig ModemSignal, rising bool) {
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Errorf("Expected Event %v but the channel was closed", sig)
+		} else if e.Signal != sig || e.Rising != rising || e.Time.IsZero() {
+			t.Errorf("Expected %v Rising %v but got %v", sig, rising, e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected Event %v but got nothing", sig)
+	}
+}
+
+func expectClosed(t *testing.T, events <-chan ModemEvent) {
+	select {
+	case e, ok := <-events:
+		if ok {
+			t.Errorf("Expected closed channel but got %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected closed channel")
+	}
+}
+
+func TestModemEvents(t *testing.T) {
+	now := time.Now()
+	events := modemEvents(unix.TIOCM_CTS|unix.TIOCM_RNG,
+		unix.TIOCM_DSR|unix.TIOCM_RNG|unix.TIOCM_CD|unix.TIOCM_RTS, false, now)
+	want := []ModemEvent{
+		{Signal: ModemCTS, Rising: false, Time: now},
+		{Signal: ModemDSR, Rising: true, Time: now},
+		{Signal: ModemDCD, Rising: true, Time: now},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %v but got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("Expected %v but got %v", want[i], events[i])
+		}
+	}
+
+	// Inverted lines
+	events = modemEvents(0, unix.TIOCM_CTS, true, now)
+	if len(events) != 1 || events[0].Rising {
+		t.Errorf("Expected falling CTS but got %v", events)
+	}
+
+	if s := (ModemCTS | ModemDCD).String(); s != "CTS|DCD" {
+		t.Errorf("Expected %q but got %q", "CTS|DCD", s)
+	}
+	if s := ModemSignal(0).String(); s != "None" {
+		t.Errorf("Expected %q but got %q", "None", s)
+	}
+}
+
+func TestModemMonitor(t *testing.T) {
+	l := newFakeLines()
+	m := newModemMonitor(l.get, l.wait, l.invert)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	all, err := m.subscribe(ctx, ModemAll)
+	if err != nil {
+		t.Fatalf("Expected No Error but got %v instead", err)
+	}
+	dcd, err := m.subscribe(context.Background(), ModemDCD)
+	if err != nil {
+		t.Fatalf("Expected No Error but got %v instead", err)
+	}
+
+	// Each Subscriber gets the lines in its mask
+	l.set(unix.TIOCM_CTS, nil)
+	expectEvent(t, all, ModemCTS, true)
+	l.set(unix.TIOCM_CTS|unix.TIOCM_CD, nil)
+	expectEvent(t, all, ModemDCD, true)
+	expectEvent(t, dcd, ModemDCD, true)
+
+	// Inversion applies to the Events
+	l.mx.Lock()
+	l.inv = true
+	l.mx.Unlock()
+	l.set(unix.TIOCM_CD, nil)
+	expectEvent(t, all, ModemCTS, true)
+
+	// Cancel ends the Subscription
+	cancel()
+	expectClosed(t, all)
+
+	// Stop ends the rest
+	m.stop()
+	expectClosed(t, dcd)
+	_, err = m.subscribe(context.Background(), ModemAll)
+	if err != ErrNotOpen {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+	l.set(0, nil) // Release the Monitor
+}
+
+func TestModemMonitorErrors(t *testing.T) {
+	l := newFakeLines()
+	m := newModemMonitor(l.get, l.wait, l.invert)
+
+	events, err := m.subscribe(context.Background(), ModemAll)
+	if err != nil {
+		t.Fatalf("Expected No Error but got %v instead", err)
+	}
+
+	// Lines that can't be read end the Subscriptions
+	l.set(0, unix.EIO)
+	expectClosed(t, events)
+	if err := m.lastError(); err != unix.EIO {
+		t.Errorf("Expected %v but got %v", unix.EIO, err)
+	}
+	_, err = m.subscribe(context.Background(), ModemAll)
+	if err != unix.EIO {
+		t.Errorf("Expected %v but got %v", unix.EIO, err)
+	}
+
+	// Monitor runs again once the lines can be read
+	l.mx.Lock()
+	l.err = nil
+	l.mx.Unlock()
+	events, err = m.subscribe(context.Background(), ModemAll)
+	if err != nil {
+		t.Fatalf("Expected No Error but got %v instead", err)
+	}
+	l.set(unix.TIOCM_DSR, nil)
+	expectEvent(t, events, ModemDSR, true)
+	m.stop()
+	l.set(0, nil)
+}
+
+func TestModemMonitorPoll(t *testing.T) {
+	l := newFakeLines()
+	wait := func() error { return unix.ENOTTY }
+	m := newModemMonitor(l.get, wait, l.invert)
+	defer m.stop()
+
+	events, err := m.subscribe(context.Background(), ModemAll)
+	if err != nil {
+		t.Fatalf("Expected No Error but got %v instead", err)
+	}
+
+	// Drivers without the wait are Polled
+	time.Sleep(2 * modemPollInterval)
+	l.mx.Lock()
+	l.status = unix.TIOCM_RNG
+	l.mx.Unlock()
+	expectEvent(t, events, ModemRI, true)
+}
+
+func TestWaitModemChange(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+
+	// Pseudo Terminals don't provide the Modem lines
+	_, err := s.WaitModemChange(context.Background(), ModemAll)
+	var pe *PortError
+	if !errors.As(err, &pe) || pe.Op != "wait modem change" {
+		t.Errorf("Expected Port Error but got %v", err)
+	}
+
+	// Lines provided by a Fake
+	l := newFakeLines()
+	s.mx.Lock()
+	s.modem = newModemMonitor(l.get, l.wait, l.invert)
+	s.mx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Lines outside the mask are not Reported
+		changed, err := s.WaitModemChange(context.Background(), ModemCTS|ModemDSR)
+		if err != nil || changed&ModemCTS == 0 || changed&ModemDCD != 0 {
+			t.Errorf("Expected %v but got %v, %v", ModemCTS|ModemDSR, changed, err)
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	l.set(unix.TIOCM_CTS|unix.TIOCM_DSR|unix.TIOCM_CD, nil)
+	<-done
+
+	// Context limits the wait
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	_, err = s.WaitModemChange(ctx, ModemAll)
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	// Close ends the wait
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.Close()
+	}()
+	_, err = s.WaitModemChange(context.Background(), ModemAll)
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+	_, err = s.ModemEvents(context.Background(), ModemAll)
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+	l.set(0, nil)
+}
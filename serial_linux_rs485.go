@@ -0,0 +1,134 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Flags of the Linux serial_rs485
+const (
+	serRS485Enabled      = 1 << 0
+	serRS485RTSOnSend    = 1 << 1
+	serRS485RTSAfterSend = 1 << 2
+	serRS485RxDuringTx   = 1 << 4
+	serRS485Terminate    = 1 << 5
+)
+
+// serialRS485 is the Linux serial_rs485
+type serialRS485 struct {
+	flags       uint32
+	delayBefore uint32 // Milliseconds
+	delayAfter  uint32 // Milliseconds
+	padding     [5]uint32
+}
+
+// rs485From converts the Configuration for the driver, the delays are
+// rounded up to milliseconds
+func rs485From(cfg *RS485Config) serialRS485 {
+	var r serialRS485
+	for _, f := range []struct {
+		en   bool
+		flag uint32
+	}{
+		{cfg.Enabled, serRS485Enabled},
+		{cfg.RTSOnSend, serRS485RTSOnSend},
+		{cfg.RTSAfterSend, serRS485RTSAfterSend},
+		{cfg.RxDuringTx, serRS485RxDuringTx},
+		{cfg.Terminate, serRS485Terminate},
+	} {
+		if f.en {
+			r.flags |= f.flag
+		}
+	}
+	ms := func(d time.Duration) uint32 {
+		if d <= 0 {
+			return 0
+		}
+		return uint32((d + time.Millisecond - 1) / time.Millisecond)
+	}
+	r.delayBefore = ms(cfg.DelayBeforeSend)
+	r.delayAfter = ms(cfg.DelayAfterSend)
+	return r
+}
+
+// rs485Config converts the settings of the driver
+func rs485Config(r *serialRS485) RS485Config {
+	return RS485Config{
+		Enabled:         r.flags&serRS485Enabled != 0,
+		RTSOnSend:       r.flags&serRS485RTSOnSend != 0,
+		RTSAfterSend:    r.flags&serRS485RTSAfterSend != 0,
+		DelayBeforeSend: time.Duration(r.delayBefore) * time.Millisecond,
+		DelayAfterSend:  time.Duration(r.delayAfter) * time.Millisecond,
+		RxDuringTx:      r.flags&serRS485RxDuringTx != 0,
+		Terminate:       r.flags&serRS485Terminate != 0,
+	}
+}
+
+func (s *serialPort) SetRS485(cfg RS485Config) (applied RS485Config, err error) {
+	defer s.wrapError("set rs485", &err)
+
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	// Check If its Open
+	if !s.opened {
+		return RS485Config{}, ErrNotOpen
+	}
+
+	r := rs485From(&cfg)
+	if _, _, e1 := unix.Syscall(
+		unix.SYS_IOCTL,
+		uintptr(s.fd),
+		uintptr(unix.TIOCSRS485),
+		uintptr(unsafe.Pointer(&r)),
+	); e1 != 0 {
+		if isUnsupported(e1) {
+			return RS485Config{}, ErrNotImplemented
+		}
+		return RS485Config{}, e1
+	}
+
+	// Driver may adjust the settings to what it supports
+	return s.rs485()
+}
+
+func (s *serialPort) RS485() (cfg RS485Config, err error) {
+	defer s.wrapError("rs485", &err)
+
+	// Establish Lock
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	// Check If its Open
+	if !s.opened {
+		return RS485Config{}, ErrNotOpen
+	}
+	return s.rs485()
+}
+
+// rs485 reads the settings of the driver under the Lock
+func (s *serialPort) rs485() (RS485Config, error) {
+	var r serialRS485
+	if _, _, e1 := unix.Syscall(
+		unix.SYS_IOCTL,
+		uintptr(s.fd),
+		uintptr(unix.TIOCGRS485),
+		uintptr(unsafe.Pointer(&r)),
+	); e1 != 0 {
+		if isUnsupported(e1) {
+			return RS485Config{}, ErrNotImplemented
+		}
+		return RS485Config{}, e1
+	}
+	return rs485Config(&r), nil
+}
@@ -0,0 +1,18 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+// +build !ppc64,!ppc64le
+
+package serial
+
+import "golang.org/x/sys/unix"
+
+// Termios ioctl requests that carry the explicit Input and Output speeds
+// needed for BOTHER (custom) baud rates
+const (
+	ioctlGetTermios = unix.TCGETS2
+	ioctlSetTermios = unix.TCSETS2
+)
@@ -8,8 +8,13 @@
 package serial
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -47,6 +52,53 @@ func loadConfig(t *testing.T) {
 	}
 }
 
+// Pseudo Terminal Pair for Tests that don't need the Hardware
+func openPty(t *testing.T) (master int, slave string) {
+	master, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("Pseudo Terminal not available - %v", err)
+	}
+	// Unlock the Slave side
+	err = unix.IoctlSetPointerInt(master, unix.TIOCSPTLCK, 0)
+	if err != nil {
+		unix.Close(master)
+		t.Skipf("Pseudo Terminal not available - %v", err)
+	}
+	// Get the Slave Number
+	n, err := unix.IoctlGetInt(master, unix.TIOCGPTN)
+	if err != nil {
+		unix.Close(master)
+		t.Skipf("Pseudo Terminal not available - %v", err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+// Dummy Instance on the Slave side of a Pseudo Terminal
+func openPtyPort(t *testing.T) (master int, s *serialPort) {
+	master, slave := openPty(t)
+	// Create Dummy Instance with required Values
+	s = &serialPort{}
+	s.conf.Name = slave
+	err := s.Open(slave)
+	if err != nil {
+		unix.Close(master)
+		t.Errorf("Error in Opening Port - %v", err)
+		t.FailNow()
+	}
+	// Raw mode so that the Data passes through unchanged
+	term, err := getTermiosFor(&Config{Baud: 9600})
+	if err == nil {
+		err = s.SetTermios(term)
+	}
+	if err != nil {
+		s.Close()
+		unix.Close(master)
+		t.Errorf("Error in Setting Raw Mode - %v", err)
+		t.FailNow()
+	}
+	return master, s
+}
+
 ///
 // Test Bench
 ///
@@ -70,19 +122,30 @@ func TestExtOpenPortConfig(t *testing.T) {
 			hasErr: true, isNil: true,
 		},
 		{
-			name: "Error Baud Rate of ESP8266 76800",
+			name: "Error Negative Baud Rate",
 			args: &Config{
-				Baud: 76800,
+				Baud: -9600,
 			},
 			hasErr: true, isNil: true,
 		},
 		{
-			name: "Error Baud Rate of Very High 4500000",
+			name: "Error Custom Baud Rate of ESP8266 76800 without Port",
 			args: &Config{
-				Baud: 4500000,
+				Baud: 76800,
 			},
 			hasErr: true, isNil: true,
 		},
+		{
+			name: "Custom Baud Rate of ESP8266 74880",
+			args: &Config{
+				Name:     cfg.PortName,
+				Baud:     74880,
+				Flow:     FlowNone,
+				Parity:   ParityNone,
+				StopBits: StopBits1,
+			},
+			hasErr: false, isNil: false,
+		},
 		{
 			name: "Compatible Baud Rate of 115200",
 			args: &Config{
@@ -293,6 +356,13 @@ func TestOpenPortBlocked(t *testing.T) {
 	// Make Sure to Close Port After wards
 	defer unix.Close(ext)
 
+	// Lock the Port as a Cooperating process would
+	err = unix.Flock(ext, unix.LOCK_EX|unix.LOCK_NB)
+	if err != nil {
+		t.Errorf("Error in Locking Port - %v", err)
+		t.FailNow()
+	}
+
 	// Attempt to Open Port Again
 	ref, err := OpenPort(&Config{
 		Name:     cfg.PortName,
@@ -625,3 +695,1104 @@ func TestLongTimeoutSetting(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestCustomBaudTermios(t *testing.T) {
+
+	// Test Type
+	tt := []struct {
+		name   string
+		baud   int
+		cbaud  uint32
+		hasErr bool
+	}{
+		{"Standard 9600", 9600, unix.B9600, false},
+		{"Standard 115200", 115200, unix.B115200, false},
+		{"Custom MIDI 31250", 31250, unix.BOTHER, false},
+		{"Custom ESP8266 74880", 74880, unix.BOTHER, false},
+		{"Custom DMX 250000", 250000, unix.BOTHER, false},
+		{"Error Zero", 0, 0, true},
+		{"Error Negative", -1, 0, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			term, err := getTermiosFor(&Config{Baud: tc.baud})
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("Expected Error but got NIL")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected No Error but got %v instead", err)
+				t.FailNow()
+			}
+			if cb := term.Cflag & (unix.CBAUD | unix.CBAUDEX); cb != tc.cbaud {
+				t.Errorf("Expected Baud Flag %#x but got %#x", tc.cbaud, cb)
+			}
+			if term.Ispeed != uint32(tc.baud) || term.Ospeed != uint32(tc.baud) {
+				t.Errorf("Expected Speed %d but got %d / %d",
+					tc.baud, term.Ispeed, term.Ospeed)
+			}
+		})
+	}
+}
+
+func TestCustomBaudReadBack(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	for _, baud := range []int{115200, 31250, 74880, 250000} {
+		err := s.SetBaud(baud)
+		if err != nil {
+			t.Errorf("Error in Setting Baud %d - %v", baud, err)
+			continue
+		}
+		got, err := s.Baud()
+		if err != nil {
+			t.Errorf("Error in Reading Baud - %v", err)
+			continue
+		}
+		if got != baud {
+			t.Errorf("Expected Baud %d but got %d", baud, got)
+		}
+	}
+}
+
+func TestDataBitsTermios(t *testing.T) {
+
+	// Test Type
+	tt := []struct {
+		name   string
+		bits   byte
+		csize  uint32
+		hasErr bool
+	}{
+		{"Default", 0, unix.CS8, false},
+		{"5 Bits", DataBits5, unix.CS5, false},
+		{"6 Bits", DataBits6, unix.CS6, false},
+		{"7 Bits", DataBits7, unix.CS7, false},
+		{"8 Bits", DataBits8, unix.CS8, false},
+		{"Error 4 Bits", 4, 0, true},
+		{"Error 9 Bits", 9, 0, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			term, err := getTermiosFor(&Config{Baud: 9600, DataBits: tc.bits})
+			if tc.hasErr {
+				if err == nil {
+					t.Errorf("Expected Error but got NIL")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected No Error but got %v instead", err)
+				t.FailNow()
+			}
+			if cs := term.Cflag & unix.CSIZE; cs != tc.csize {
+				t.Errorf("Expected Character Size %#x but got %#x", tc.csize, cs)
+			}
+		})
+	}
+}
+
+func TestSetDataBits(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	err := s.SetDataBits(DataBits7)
+	if err != nil {
+		t.Errorf("Error in Setting Data Bits - %v", err)
+		t.FailNow()
+	}
+	// Pseudo Terminal always forces CS8 hence only the Configuration is checked
+	if s.conf.DataBits != DataBits7 {
+		t.Errorf("Expected Configuration to store 7 Data Bits")
+	}
+
+	err = s.SetDataBits(9)
+	if err == nil {
+		t.Errorf("Expected Error but got NIL")
+	}
+}
+
+func TestReadContextCancel(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	// Blocks without any Data till Cancelled
+	tStart := time.Now()
+	n, err := s.ReadContext(ctx, make([]byte, 10))
+	tDur := time.Since(tStart)
+	if err != context.Canceled {
+		t.Errorf("Expected %v but got %v", context.Canceled, err)
+	}
+	if n != 0 {
+		t.Errorf("Expected Number of Bytes 0 but Got %v", n)
+	}
+	if tDur > time.Second {
+		t.Errorf("Cancellation took too long %v", tDur)
+	}
+
+	// Data is Read normally after that
+	_, err = unix.Write(master, []byte("Hari Aum"))
+	if err != nil {
+		t.Errorf("Error in Writing to Master - %v", err)
+		t.FailNow()
+	}
+	buf := make([]byte, 10)
+	n, err = s.ReadContext(context.Background(), buf)
+	if err != nil || string(buf[:n]) != "Hari Aum" {
+		t.Errorf("Expected %q but got %q with %v", "Hari Aum", buf[:n], err)
+	}
+}
+
+func TestReadContextDeadline(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	n, err := s.ReadContext(ctx, make([]byte, 10))
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	if n != 0 {
+		t.Errorf("Expected Number of Bytes 0 but Got %v", n)
+	}
+}
+
+func TestWriteContextDeadline(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Nobody reads the Master hence the Write would block
+	buf := make([]byte, 1<<20)
+	n, err := s.WriteContext(ctx, buf)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	if n >= len(buf) {
+		t.Errorf("Expected a Partial Write but Got %v", n)
+	}
+}
+
+func TestReadTimeoutConfig(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+	s.conf.ReadTimeout = 20 * time.Millisecond
+
+	// Timeout returns no data and no error
+	tStart := time.Now()
+	n, err := s.Read(make([]byte, 10))
+	tDur := time.Since(tStart)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	if n != 0 {
+		t.Errorf("Expected Number of Bytes 0 but Got %v", n)
+	}
+	if tDur < s.conf.ReadTimeout {
+		t.Errorf("Expected time Duration to be Min %v but got %v",
+			s.conf.ReadTimeout, tDur)
+	}
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	// Reader Blocked on the Port without any Data
+	rBuf := make([]byte, 10)
+	rDone := make(chan int)
+	go func() {
+		n, err := s.Read(rBuf)
+		if err != nil {
+			t.Errorf("Expected No Error in Reception instead Got - %v", err)
+		}
+		rDone <- n
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Writer and Configuration must not Stall behind the Reader
+	wDone := make(chan error)
+	go func() {
+		_, err := s.Write([]byte("Hari Aum"))
+		if err == nil {
+			err = s.SetBaud(115200)
+		}
+		if err == nil {
+			err = s.SignalInvert(false)
+		}
+		wDone <- err
+	}()
+	select {
+	case err := <-wDone:
+		if err != nil {
+			t.Errorf("Expected No Error in Transmit instead Got - %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Write Stalled behind a Blocked Read")
+		t.FailNow()
+	}
+
+	// Transmitted Data reaches the Master
+	mBuf := make([]byte, 10)
+	n, err := unix.Read(master, mBuf)
+	if err != nil || string(mBuf[:n]) != "Hari Aum" {
+		t.Errorf("Expected %q but got %q with %v", "Hari Aum", mBuf[:n], err)
+	}
+
+	// Unblock the Reader
+	_, err = unix.Write(master, []byte("Aum"))
+	if err != nil {
+		t.Errorf("Error in Writing to Master - %v", err)
+		t.FailNow()
+	}
+	select {
+	case n := <-rDone:
+		if string(rBuf[:n]) != "Aum" {
+			t.Errorf("Expected %q but got %q", "Aum", rBuf[:n])
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Reader was not Released")
+	}
+}
+
+func TestFullDuplex(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	const chunks = 100
+	chunk := []byte("0123456789abcdef")
+	total := chunks * len(chunk)
+
+	// Master Echoes everything back
+	go func() {
+		buf := make([]byte, 256)
+		for echoed := 0; echoed < total; {
+			n, err := unix.Read(master, buf)
+			if err != nil {
+				return
+			}
+			unix.Write(master, buf[:n])
+			echoed += n
+		}
+	}()
+
+	// Reader and Writer run in Parallel
+	var rx []byte
+	rDone := make(chan error)
+	go func() {
+		buf := make([]byte, 64)
+		for len(rx) < total {
+			n, err := s.Read(buf)
+			if err != nil {
+				rDone <- err
+				return
+			}
+			rx = append(rx, buf[:n]...)
+		}
+		rDone <- nil
+	}()
+	for i := 0; i < chunks; i++ {
+		_, err := s.Write(chunk)
+		if err != nil {
+			t.Errorf("Expected No Error in Transmit instead Got - %v", err)
+			t.FailNow()
+		}
+	}
+
+	select {
+	case err := <-rDone:
+		if err != nil {
+			t.Errorf("Expected No Error in Reception instead Got - %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Reception did not complete")
+		t.FailNow()
+	}
+	for i := 0; i < chunks; i++ {
+		got := string(rx[i*len(chunk) : (i+1)*len(chunk)])
+		if got != string(chunk) {
+			t.Errorf("Expected %q but got %q at chunk %d", chunk, got, i)
+			break
+		}
+	}
+}
+
+func TestCloseReleasesReader(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+
+	rDone := make(chan error)
+	go func() {
+		_, err := s.Read(make([]byte, 10))
+		rDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	err := s.Close()
+	if err != nil {
+		t.Errorf("Error in Closing Port - %v", err)
+	}
+	select {
+	case err := <-rDone:
+		if !errors.Is(err, ErrNotOpen) {
+			t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Close did not Release the Reader")
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	// Well below the 100 mS resolution of VTIME
+	timeout := 20 * time.Millisecond
+	err := s.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		t.Errorf("Error in Setting Deadline - %v", err)
+		t.FailNow()
+	}
+
+	tStart := time.Now()
+	n, err := s.Read(make([]byte, 10))
+	tDur := time.Since(tStart)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected %v but got %v", os.ErrDeadlineExceeded, err)
+	}
+	if n != 0 {
+		t.Errorf("Expected Number of Bytes 0 but Got %v", n)
+	}
+	if tDur < timeout || tDur >= 100*time.Millisecond {
+		t.Errorf("Expected time Duration close to %v but got %v", timeout, tDur)
+	}
+
+	// Expired Deadline applies to further Reads till its Cleared
+	_, err = s.Read(make([]byte, 10))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected %v but got %v", os.ErrDeadlineExceeded, err)
+	}
+	err = s.SetDeadline(time.Time{})
+	if err != nil {
+		t.Errorf("Error in Clearing Deadline - %v", err)
+	}
+	_, err = unix.Write(master, []byte("Hari Aum"))
+	if err != nil {
+		t.Errorf("Error in Writing to Master - %v", err)
+		t.FailNow()
+	}
+	buf := make([]byte, 10)
+	n, err = s.Read(buf)
+	if err != nil || string(buf[:n]) != "Hari Aum" {
+		t.Errorf("Expected %q but got %q with %v", "Hari Aum", buf[:n], err)
+	}
+}
+
+func TestReadDeadlinePending(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	rDone := make(chan error)
+	go func() {
+		_, err := s.Read(make([]byte, 10))
+		rDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Abort the Pending Read
+	err := s.SetReadDeadline(time.Now())
+	if err != nil {
+		t.Errorf("Error in Setting Deadline - %v", err)
+	}
+	select {
+	case err := <-rDone:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("Expected %v but got %v", os.ErrDeadlineExceeded, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Deadline did not Release the Reader")
+	}
+}
+
+func TestWriteDeadline(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	err := s.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	if err != nil {
+		t.Errorf("Error in Setting Deadline - %v", err)
+		t.FailNow()
+	}
+
+	// Nobody reads the Master hence the Write would block
+	buf := make([]byte, 1<<20)
+	n, err := s.Write(buf)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected %v but got %v", os.ErrDeadlineExceeded, err)
+	}
+	if n >= len(buf) {
+		t.Errorf("Expected a Partial Write but Got %v", n)
+	}
+}
+
+func TestLongReadTimeoutTermios(t *testing.T) {
+
+	// Timeouts no longer depend on VTIME hence no clamping at 25.5s
+	term, err := getTermiosFor(&Config{Baud: 9600, ReadTimeout: time.Minute})
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+	if term.Cc[unix.VMIN] != 1 || term.Cc[unix.VTIME] != 0 {
+		t.Errorf("Expected VMIN 1 and VTIME 0 but got %d and %d",
+			term.Cc[unix.VMIN], term.Cc[unix.VTIME])
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	gap := 50 * time.Millisecond
+
+	// Frame arrives in pieces closer than the gap followed by silence
+	go func() {
+		unix.Write(master, []byte("Hari "))
+		time.Sleep(gap / 5)
+		unix.Write(master, []byte("Aum"))
+		time.Sleep(3 * gap)
+		unix.Write(master, []byte("Next"))
+	}()
+
+	buf := make([]byte, 20)
+	n, err := s.ReadFrame(buf, gap)
+	if err != nil || string(buf[:n]) != "Hari Aum" {
+		t.Errorf("Expected %q but got %q with %v", "Hari Aum", buf[:n], err)
+	}
+
+	n, err = s.ReadFrame(buf, gap)
+	if err != nil || string(buf[:n]) != "Next" {
+		t.Errorf("Expected %q but got %q with %v", "Next", buf[:n], err)
+	}
+
+	// Full Buffer completes the Frame
+	unix.Write(master, []byte("0123456789"))
+	time.Sleep(gap / 5)
+	n, err = s.ReadFrame(buf[:4], gap)
+	if err != nil || string(buf[:n]) != "0123" {
+		t.Errorf("Expected %q but got %q with %v", "0123", buf[:n], err)
+	}
+}
+
+func TestReadFrameTimeout(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+	s.conf.ReadTimeout = 20 * time.Millisecond
+
+	// No Frame Started before the Read Timeout
+	n, err := s.ReadFrame(make([]byte, 10), 0)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	if n != 0 {
+		t.Errorf("Expected Number of Bytes 0 but Got %v", n)
+	}
+}
+
+func TestReadDisconnected(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer s.Close()
+
+	rDone := make(chan error)
+	go func() {
+		_, err := s.Read(make([]byte, 10))
+		rDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Hang up the Slave side
+	unix.Close(master)
+	select {
+	case err := <-rDone:
+		if !errors.Is(err, ErrDisconnected) {
+			t.Errorf("Expected %v but got %v", ErrDisconnected, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Hang up did not Release the Reader")
+		t.FailNow()
+	}
+
+	// Port is Closed
+	_, err := s.Read(make([]byte, 10))
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+	err = s.Close()
+	if !errors.Is(err, ErrPortNotInitialized) {
+		t.Errorf("Expected %v but got %v", ErrPortNotInitialized, err)
+	}
+}
+
+func TestReadCarrierLost(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	// Honour the Carrier
+	err := s.Reconfigure(Config{Baud: 9600, Carrier: true})
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+	term, err := s.GetTermios()
+	if err != nil || term.Cflag&unix.CLOCAL != 0 || term.Cflag&unix.HUPCL == 0 {
+		t.Errorf("Expected CLOCAL cleared and HUPCL set but got %#x, %v", term.Cflag, err)
+	}
+
+	rDone := make(chan error)
+	go func() {
+		_, err := s.Read(make([]byte, 10))
+		rDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Hang up the Line as the Kernel does on Carrier loss, the device
+	// stays present
+	s.mx.Lock()
+	fd := s.fd
+	s.mx.Unlock()
+	err = unix.IoctlSetInt(fd, unix.TIOCVHANGUP, 0)
+	if err != nil {
+		s.Close()
+		<-rDone
+		t.Skipf("Hang up not available - %v", err)
+	}
+	select {
+	case err := <-rDone:
+		if !errors.Is(err, ErrCarrierLost) || errors.Is(err, ErrDisconnected) {
+			t.Errorf("Expected %v but got %v", ErrCarrierLost, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Hang up did not Release the Reader")
+		t.FailNow()
+	}
+
+	// Port is Closed
+	_, err = s.Read(make([]byte, 10))
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+}
+
+func TestReadCarrierUnplugged(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer s.Close()
+
+	err := s.Reconfigure(Config{Baud: 9600, Carrier: true})
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+
+	rDone := make(chan error)
+	go func() {
+		_, err := s.Read(make([]byte, 10))
+		rDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Device goes away while its node is still present
+	unix.Close(master)
+	select {
+	case err := <-rDone:
+		if !errors.Is(err, ErrDisconnected) || errors.Is(err, ErrCarrierLost) {
+			t.Errorf("Expected %v but got %v", ErrDisconnected, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Hang up did not Release the Reader")
+		t.FailNow()
+	}
+}
+
+func TestWriteDisconnected(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer s.Close()
+
+	// Hang up the Slave side
+	unix.Close(master)
+	_, err := s.Write([]byte("Hello"))
+	if !errors.Is(err, ErrDisconnected) {
+		t.Errorf("Expected %v but got %v", ErrDisconnected, err)
+	}
+	_, err = s.Write([]byte("Hello"))
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+}
+
+func TestTimeoutNotDisconnected(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+	s.conf.ReadTimeout = 20 * time.Millisecond
+
+	// Timeout is only no data and the Port stays Open
+	n, err := s.Read(make([]byte, 10))
+	if err != nil || n != 0 {
+		t.Errorf("Expected 0 Bytes and No Error but got %v, %v", n, err)
+	}
+	_, err = unix.Write(master, []byte("A"))
+	if err != nil {
+		t.Errorf("Error in Writing - %v", err)
+	}
+	n, err = s.Read(make([]byte, 10))
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 Byte and No Error but got %v, %v", n, err)
+	}
+}
+
+func TestPortErrorErrno(t *testing.T) {
+	tests := []struct {
+		errno unix.Errno
+		want  error
+	}{
+		{unix.EBUSY, ErrBusy},
+		{unix.EACCES, ErrAccessDenied},
+		{unix.EPERM, ErrAccessDenied},
+		{unix.ENOENT, os.ErrNotExist},
+		{unix.EIO, ErrDisconnected},
+		{unix.ENODEV, ErrDisconnected},
+		{unix.EBADF, ErrNotOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.errno.Error(), func(t *testing.T) {
+			err := newPortError("open", "/dev/ttyUSB0", tt.errno)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v to match %v", err, tt.want)
+			}
+			if !errors.Is(err, tt.errno) {
+				t.Errorf("Expected %v to match %v", err, tt.errno)
+			}
+		})
+	}
+	err := newPortError("open", "/dev/ttyUSB0", unix.EINVAL)
+	for _, target := range []error{ErrBusy, ErrAccessDenied, ErrDisconnected, ErrNotOpen} {
+		if errors.Is(err, target) {
+			t.Errorf("Expected %v not to match %v", err, target)
+		}
+	}
+}
+
+func TestPortErrorOps(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	name := s.conf.Name
+
+	// Second Open of the same Port, refused by the flock for root and by
+	// TIOCEXCL for the other users with the same Error
+	_, err := OpenPort(&Config{Name: name, Baud: 9600})
+	var pe *PortError
+	if !errors.As(err, &pe) || pe.Op != "open" || pe.Port != name {
+		t.Errorf("Expected PortError for open %s but got %v", name, err)
+	}
+	if !errors.Is(err, ErrAlreadyOpen) {
+		t.Errorf("Expected %v but got %v", ErrAlreadyOpen, err)
+	}
+	owner := fmt.Sprintf("locked by pid %d", os.Getpid())
+	if _, serr := os.Stat(procLocks); serr == nil && err != nil &&
+		!strings.Contains(err.Error(), owner) {
+		t.Errorf("Expected %q in the Error but got %v", owner, err)
+	}
+
+	// Deadline expiry is a timeout like on net.Conn
+	s.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = s.Read(make([]byte, 1))
+	if !errors.As(err, &pe) || !os.IsTimeout(err) {
+		t.Errorf("Expected PortError with a timeout but got %v", err)
+	}
+	if nerr, ok := err.(interface{ Timeout() bool }); !ok || !nerr.Timeout() {
+		t.Errorf("Expected Timeout method of %v", err)
+	}
+	s.SetReadDeadline(time.Time{})
+
+	// Operations on the Closed Port
+	s.Close()
+	ops := []struct {
+		op string
+		fn func() error
+	}{
+		{"read", func() error { _, err := s.Read(make([]byte, 1)); return err }},
+		{"write", func() error { _, err := s.Write([]byte("A")); return err }},
+		{"set baud", func() error { return s.SetBaud(9600) }},
+		{"cts", func() error { _, err := s.Cts(); return err }},
+		{"send break", func() error { return s.SendBreak(false) }},
+	}
+	for _, tt := range ops {
+		err := tt.fn()
+		if !errors.As(err, &pe) || pe.Op != tt.op || pe.Port != name {
+			t.Errorf("Expected PortError for %s %s but got %v", tt.op, name, err)
+		}
+		if !errors.Is(err, ErrNotOpen) {
+			t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+		}
+	}
+	err = s.Close()
+	if !errors.Is(err, ErrPortNotInitialized) {
+		t.Errorf("Expected %v but got %v", ErrPortNotInitialized, err)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	want := Config{
+		Name:        s.conf.Name,
+		Baud:        19200,
+		DataBits:    DataBits8,
+		ReadTimeout: 50 * time.Millisecond,
+		Parity:      ParityNone, // Pseudo Terminal has no Parity
+		StopBits:    StopBits2,
+		Flow:        FlowHardware,
+	}
+	err := s.Reconfigure(want)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+
+	got, err := s.Config()
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	if got != want {
+		t.Errorf("Config() =\n%v\nwant\n%v", &got, &want)
+	}
+
+	// Read back from the Termios
+	term, err := s.GetTermios()
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	if term.Ospeed != 19200 || term.Cflag&unix.CSTOPB == 0 || term.Cflag&unix.CRTSCTS == 0 {
+		t.Errorf("Expected Termios to be Applied but got %+v", term)
+	}
+}
+
+func TestConfigFromTermios(t *testing.T) {
+	tests := []Config{
+		{Baud: 9600, DataBits: DataBits8},
+		{Baud: 74880, DataBits: DataBits7, Parity: ParityEven},
+		{Baud: 115200, DataBits: DataBits6, Parity: ParityOdd, StopBits: StopBits2},
+		{Baud: 300, DataBits: DataBits5, Parity: ParityMark, Flow: FlowSoft},
+		{Baud: 250000, DataBits: DataBits8, Parity: ParitySpace, Flow: FlowHardware},
+		{Baud: 57600, DataBits: DataBits8, Flow: FlowHardware, Carrier: true},
+		{Baud: 38400, DataBits: DataBits7, Parity: ParityOdd, MarkErrors: true},
+		{Baud: 4800, DataBits: DataBits8, MarkBreaks: true},
+	}
+	for _, want := range tests {
+		t.Run(want.String(), func(t *testing.T) {
+			term, err := getTermiosFor(&want)
+			if err != nil {
+				t.Errorf("Expected No Error but got %v instead", err)
+				t.FailNow()
+			}
+			var got Config
+			configFromTermios(&got, &term)
+			if got != want {
+				t.Errorf("configFromTermios() = %v, want %v", &got, &want)
+			}
+		})
+	}
+}
+
+func TestReconfigureErrors(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	before, err := s.Config()
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"Invalid Baud", Config{Baud: -1}},
+		{"Invalid Parity", Config{Baud: 9600, Parity: ParitySpace + 1}},
+		{"Invalid Stop Bits", Config{Baud: 9600, StopBits: StopBits15}},
+		{"Invalid Flow", Config{Baud: 9600, Flow: FlowSoft + 1}},
+		{"Different Port", Config{Name: "/dev/ttyUSB9", Baud: 9600}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Reconfigure(tt.cfg); err == nil {
+				t.Errorf("Expected Error but got NIL")
+			}
+		})
+	}
+
+	// Nothing Changed
+	after, err := s.Config()
+	if err != nil || after != before {
+		t.Errorf("Expected %v but got %v, %v", &before, &after, err)
+	}
+
+	// Closed Port
+	s.Close()
+	if err := s.Reconfigure(before); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+	if _, err := s.Config(); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+}
+
+// Wait for the Input queue of the Pseudo Terminal to fill
+func waitInWaiting(t *testing.T, s *serialPort, want int) int {
+	var n int
+	var err error
+	for i := 0; i < 100; i++ {
+		n, err = s.InWaiting()
+		if err != nil {
+			t.Errorf("Expected No Error but got %v instead", err)
+			return n
+		}
+		if n == want {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return n
+}
+
+func TestFlushQueues(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	_, err := unix.Write(master, []byte("Hello"))
+	if err != nil {
+		t.Errorf("Error in Writing - %v", err)
+	}
+	if n := waitInWaiting(t, s, 5); n != 5 {
+		t.Errorf("Expected 5 Bytes Waiting but got %v", n)
+	}
+
+	// Output only keeps the Input
+	err = s.Flush(false, true)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	if n, _ := s.InWaiting(); n != 5 {
+		t.Errorf("Expected 5 Bytes Waiting but got %v", n)
+	}
+
+	// Input discards the Received bytes
+	err = s.Flush(true, false)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	if n, _ := s.InWaiting(); n != 0 {
+		t.Errorf("Expected 0 Bytes Waiting but got %v", n)
+	}
+
+	n, err := s.OutWaiting()
+	if err != nil || n != 0 {
+		t.Errorf("Expected 0 Bytes and No Error but got %v, %v", n, err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+	defer s.Close()
+
+	_, err := s.Write([]byte("Hello"))
+	if err != nil {
+		t.Errorf("Error in Writing - %v", err)
+	}
+	err = s.Drain()
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	if n, _ := s.OutWaiting(); n != 0 {
+		t.Errorf("Expected 0 Bytes Waiting but got %v", n)
+	}
+
+	// Cancelled Context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = s.DrainContext(ctx)
+	if err != context.Canceled {
+		t.Errorf("Expected %v but got %v", context.Canceled, err)
+	}
+
+	// Closed Port
+	s.Close()
+	for _, err := range []error{s.Drain(), s.Flush(true, true)} {
+		if !errors.Is(err, ErrNotOpen) {
+			t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+		}
+	}
+	if _, err := s.InWaiting(); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	ic := serialICounter{
+		cts: 1, dsr: 2, rng: 3, dcd: 4, rx: 5, tx: 6,
+		frame: 7, overrun: 8, parity: 9, brk: 10, bufOverrun: 11,
+	}
+	want := Counters{
+		Rx: 5, Tx: 6, Frame: 7, Parity: 9, Overrun: 8, BufOverrun: 11,
+		Break: 10, CTS: 1, DSR: 2, RI: 3, DCD: 4,
+	}
+	if got := countersFrom(&ic); got != want {
+		t.Errorf("Expected %+v but got %+v", want, got)
+	}
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+
+	// Pseudo Terminals don't keep Counters
+	_, err := s.Counters()
+	var pe *PortError
+	if !errors.As(err, &pe) || pe.Op != "counters" {
+		t.Errorf("Expected Port Error but got %v", err)
+	}
+
+	s.Close()
+	_, err = s.Counters()
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+}
+
+func TestSetSignals(t *testing.T) {
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+
+	// Only the output lines
+	err := s.SetSignals(ModemCTS, 0)
+	var pe *PortError
+	if !errors.As(err, &pe) || pe.Op != "set signals" {
+		t.Errorf("Expected Port Error but got %v", err)
+	}
+
+	// Pseudo Terminals don't have the Modem lines, the Sequence stops
+	// at the first Step
+	start := time.Now()
+	err = s.PulseSignals(context.Background(), ResetArduino)
+	if !errors.Is(err, unix.ENOTTY) || !errors.As(err, &pe) || pe.Op != "pulse signals" {
+		t.Errorf("Expected %v but got %v", unix.ENOTTY, err)
+	}
+	if took := time.Since(start); took > 50*time.Millisecond {
+		t.Errorf("Expected the Sequence to stop but took %v", took)
+	}
+
+	s.Close()
+	err = s.SetSignals(ModemRTS, 0)
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+	err = s.Rts(true)
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+}
+
+func TestRS485Config(t *testing.T) {
+	cfg := RS485Config{
+		Enabled:         true,
+		RTSOnSend:       true,
+		DelayBeforeSend: 1500 * time.Microsecond,
+		DelayAfterSend:  2 * time.Millisecond,
+		RxDuringTx:      true,
+		Terminate:       true,
+	}
+	r := rs485From(&cfg)
+	if r.flags != serRS485Enabled|serRS485RTSOnSend|serRS485RxDuringTx|serRS485Terminate {
+		t.Errorf("Expected Flags %#x but got %#x", 0x33, r.flags)
+	}
+
+	// Delays are rounded up to milliseconds
+	want := cfg
+	want.DelayBeforeSend = 2 * time.Millisecond
+	if got := rs485Config(&r); got != want {
+		t.Errorf("Expected %+v but got %+v", want, got)
+	}
+
+	master, s := openPtyPort(t)
+	defer unix.Close(master)
+
+	// Pseudo Terminals have no RS485 mode
+	_, err := s.SetRS485(cfg)
+	var pe *PortError
+	if !errors.Is(err, ErrNotImplemented) || !errors.As(err, &pe) || pe.Op != "set rs485" {
+		t.Errorf("Expected %v but got %v", ErrNotImplemented, err)
+	}
+
+	s.Close()
+	_, err = s.RS485()
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Interval for Polling the sysfs when kernel uevents are not available
+var watchPollInterval = time.Second
+
+// Platform Specific Port Watch Function
+func watchPorts(ctx context.Context) (<-chan PortEvent, error) {
+	changes, err := ueventChanges(ctx)
+	if err != nil {
+		// Fallback on Polling the sysfs
+		changes = pollChanges(ctx, watchPollInterval)
+	}
+	return watchChanges(ctx, listPorts, changes)
+}
+
+// watchChanges lists the Ports on every change notification and reports the
+// difference to the previous list as events, the Ports present at the start
+// are reported as Added
+func watchChanges(ctx context.Context, list func() ([]PortInfo, error),
+	changes <-chan struct{}) (<-chan PortEvent, error) {
+	// Initial List
+	ports, err := list()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan PortEvent, 16)
+	go func() {
+		defer close(events)
+
+		// Send the Event unless Cancelled
+		send := func(e PortEvent) bool {
+			select {
+			case events <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		known := map[string]PortInfo{}
+		for {
+			// Report the Difference
+			current := map[string]PortInfo{}
+			for _, p := range ports {
+				current[p.Name] = p
+			}
+			for name, old := range known {
+				if p, ok := current[name]; !ok || !samePort(old, p) {
+					if !send(PortEvent{Type: PortRemoved, Port: old}) {
+						return
+					}
+					delete(known, name)
+				}
+			}
+			for _, p := range ports {
+				if _, ok := known[p.Name]; !ok {
+					if !send(PortEvent{Type: PortAdded, Port: p}) {
+						return
+					}
+				}
+			}
+			known = current
+
+			// Wait for the Next Change
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-changes:
+				if !ok {
+					return
+				}
+			}
+			// Keep the Previous list on Error and retry at the next Change
+			if l, err := list(); err == nil {
+				ports = l
+			}
+		}
+	}()
+	return events, nil
+}
+
+// samePort checks if the Port is the same device, the persistent links are
+// not compared as udev creates them after the kernel reports the device
+func samePort(a, b PortInfo) bool {
+	a.Links, b.Links = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// pollChanges notifies a possible change at every interval
+func pollChanges(ctx context.Context, interval time.Duration) <-chan struct{} {
+	changes := make(chan struct{})
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			select {
+			case changes <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes
+}
+
+// ueventChanges notifies the changes of tty devices reported by the kernel
+// uevents over netlink
+func ueventChanges(ctx context.Context) (<-chan struct{}, error) {
+	fd, err := unix.Socket(
+		unix.AF_NETLINK,
+		unix.SOCK_DGRAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK,
+		unix.NETLINK_KOBJECT_UEVENT,
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = unix.Bind(fd, &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: 1, // Kernel uevents
+	})
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	// Runtime Poller allows the Close to release the Read
+	f := os.NewFile(uintptr(fd), "uevent")
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	changes := make(chan struct{}, 1)
+	go readUevents(ctx, f.Read, changes)
+	return changes, nil
+}
+
+// readUevents reads the uevents till the socket is closed, bursts of them
+// are coalesced in to a single notification. Errors such as ENOBUFS for the
+// uevents lost in a burst are notified too, as the devices are listed again.
+func readUevents(ctx context.Context, read func(b []byte) (int, error),
+	changes chan<- struct{}) {
+	defer close(changes)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+	buf := make([]byte, 8192)
+	for {
+		n, err := read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+		if err != nil {
+			notify()
+			if errors.Is(err, unix.ENOBUFS) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			// Retry later on the other Errors
+			t := time.NewTimer(watchPollInterval)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+			}
+			continue
+		}
+		if isTTYUevent(buf[:n]) {
+			notify()
+		}
+	}
+}
+
+// isTTYUevent checks if the uevent message "ACTION@DEVPATH\0KEY=VALUE\0..."
+// belongs to the tty subsystem
+func isTTYUevent(msg []byte) bool {
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		if bytes.Equal(field, []byte("SUBSYSTEM=tty")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Wait for an Event with a Timeout
+func nextEvent(t *testing.T, events <-chan PortEvent) (PortEvent, bool) {
+	select {
+	case e, ok := <-events:
+		return e, ok
+	case <-time.After(time.Second):
+		t.Errorf("Expected an Event but got nothing")
+		t.FailNow()
+	}
+	return PortEvent{}, false
+}
+
+func TestWatchChanges(t *testing.T) {
+
+	usb0 := PortInfo{Name: "ttyUSB0", Driver: "ftdi_sio", IsUSB: true, SerialNumber: "A1"}
+	usb0b := PortInfo{Name: "ttyUSB0", Driver: "ftdi_sio", IsUSB: true, SerialNumber: "B2"}
+	acm0 := PortInfo{Name: "ttyACM0", Driver: "cdc_acm", IsUSB: true}
+
+	// Injected Port lists for every change
+	var mx sync.Mutex
+	lists := [][]PortInfo{
+		{usb0},
+		{usb0, acm0},
+		{acm0},
+		{acm0, usb0b},
+		{acm0, func() PortInfo { p := usb0b; p.Links = []string{"by-id"}; return p }()},
+	}
+	list := func() ([]PortInfo, error) {
+		mx.Lock()
+		defer mx.Unlock()
+		l := lists[0]
+		if len(lists) > 1 {
+			lists = lists[1:]
+		}
+		return l, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{})
+	events, err := watchChanges(ctx, list, changes)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+
+	want := []struct {
+		change bool
+		event  PortEvent
+	}{
+		{false, PortEvent{Type: PortAdded, Port: usb0}},
+		{true, PortEvent{Type: PortAdded, Port: acm0}},
+		{true, PortEvent{Type: PortRemoved, Port: usb0}},
+		{true, PortEvent{Type: PortAdded, Port: usb0b}},
+	}
+	for i, w := range want {
+		if w.change {
+			changes <- struct{}{}
+		}
+		e, ok := nextEvent(t, events)
+		if !ok || !reflect.DeepEqual(e, w.event) {
+			t.Errorf("Event %d expected %+v but got %+v", i, w.event, e)
+		}
+	}
+
+	// Only the Links changed hence no Event
+	changes <- struct{}{}
+	select {
+	case e := <-events:
+		t.Errorf("Expected no Event but got %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Cancel closes the Events
+	cancel()
+	if _, ok := nextEvent(t, events); ok {
+		t.Errorf("Expected Events to be Closed")
+	}
+}
+
+func TestWatchReplaced(t *testing.T) {
+
+	old := PortInfo{Name: "ttyUSB0", IsUSB: true, SerialNumber: "A1"}
+	replaced := PortInfo{Name: "ttyUSB0", IsUSB: true, SerialNumber: "B2"}
+	calls := 0
+	list := func() ([]PortInfo, error) {
+		calls++
+		if calls == 1 {
+			return []PortInfo{old}, nil
+		}
+		return []PortInfo{replaced}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{})
+	events, err := watchChanges(ctx, list, changes)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+	nextEvent(t, events)
+
+	// Different device on the same Name is Removed and Added
+	changes <- struct{}{}
+	e, _ := nextEvent(t, events)
+	if e.Type != PortRemoved || e.Port.SerialNumber != "A1" {
+		t.Errorf("Expected Removal of A1 but got %+v", e)
+	}
+	e, _ = nextEvent(t, events)
+	if e.Type != PortAdded || e.Port.SerialNumber != "B2" {
+		t.Errorf("Expected Addition of B2 but got %+v", e)
+	}
+
+	// Closed Source stops the Watch
+	close(changes)
+	if _, ok := nextEvent(t, events); ok {
+		t.Errorf("Expected Events to be Closed")
+	}
+}
+
+func TestIsTTYUevent(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want bool
+	}{
+		{
+			name: "tty Add",
+			msg:  "add@/devices/pci0000:00/usb1/1-1/1-1:1.0/ttyUSB0/tty/ttyUSB0\x00ACTION=add\x00SUBSYSTEM=tty\x00DEVNAME=ttyUSB0\x00",
+			want: true,
+		},
+		{
+			name: "usb Add",
+			msg:  "add@/devices/pci0000:00/usb1/1-1\x00ACTION=add\x00SUBSYSTEM=usb\x00",
+			want: false,
+		},
+		{
+			name: "Not a Subsystem field",
+			msg:  "add@/devices/virtual/SUBSYSTEM=tty\x00ACTION=add\x00",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTTYUevent([]byte(tt.msg)); got != tt.want {
+				t.Errorf("isTTYUevent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadUevents(t *testing.T) {
+	// Lost uevents, a tty uevent and the Close of the socket
+	reads := make(chan error)
+	read := func(b []byte) (int, error) {
+		err, ok := <-reads
+		if !ok {
+			return 0, &os.PathError{Op: "read", Path: "uevent", Err: os.ErrClosed}
+		}
+		if err != nil {
+			return 0, &os.PathError{Op: "read", Path: "uevent", Err: err}
+		}
+		return copy(b, "add@/devices/virtual/tty/ttyS9\x00SUBSYSTEM=tty\x00"), nil
+	}
+	changes := make(chan struct{}, 1)
+	go readUevents(context.Background(), read, changes)
+
+	for _, err := range []error{unix.ENOBUFS, unix.EINTR, nil} {
+		reads <- err
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				t.Fatalf("Expected the reading to continue after %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a Change notification for %v", err)
+		}
+	}
+
+	close(reads)
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Errorf("Expected the notifications to end with the Close")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the notifications to end with the Close")
+	}
+}
+
+func TestPollChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := pollChanges(ctx, 5*time.Millisecond)
+
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Errorf("Expected a Change notification")
+	}
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := Watch(ctx)
+	if err != nil {
+		cancel()
+		t.Skipf("sysfs not available - %v", err)
+	}
+	cancel()
+	for e := range events {
+		t.Logf("Info - %+v", e)
+	}
+}
@@ -0,0 +1,730 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+package serial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Default Backoff between the Reconnection attempts
+const (
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// ConnState defines the Connection state of a ReconnectPort
+type ConnState byte
+
+// Connection States
+const (
+	// StateDisconnected - Device is not available, reconnection is in progress
+	StateDisconnected ConnState = iota
+	// StateConnected - Device is open and configured
+	StateConnected
+	// StateClosed - Port was closed by the user
+	StateClosed
+)
+
+func (c ConnState) String() string {
+	switch c {
+	case StateDisconnected:
+		return "Disconnected"
+	case StateConnected:
+		return "Connected"
+	case StateClosed:
+		return "Closed"
+	}
+	return "Unknown"
+}
+
+// ReconnectConfig is the configuration of a ReconnectPort
+type ReconnectConfig struct {
+	Config                      // Port Configuration applied on every Open
+	SerialNumber  string        // Open the USB Port with this Serial Number instead of Config.Name
+	Backoff       time.Duration // First delay between the attempts, doubled on every failure
+	MaxBackoff    time.Duration // Upper limit of the delay between the attempts
+	OnStateChange func(state ConnState, err error)
+}
+
+// ReconnectPort is a Port that opens the device again after it gets
+// disconnected. The Configuration along with the changes done through the
+// Port (Reconfigure, Baud, Data bits, Signal Inversion, RTS, DTR and
+// Deadlines) is applied again on every reconnection.
+//
+// The operation that finds the device gone returns ErrDisconnected, further
+// Read and Write operations wait for the device to be back, limited by
+// their Context or Deadline and the Reads by Config.ReadTimeout. Settings done while disconnected are applied
+// on reconnection, read backs return ErrDisconnected.
+type ReconnectPort struct {
+	rc ReconnectConfig
+
+	mx     sync.Mutex
+	port   Port          // Current Port, nil while disconnected
+	ready  chan struct{} // Closed when connected
+	done   chan struct{} // Closed on Close
+	closed bool
+	name   string // Device of the current or the last Port
+
+	// Settings to apply again
+	rts, dtr *bool
+	rd, wd   time.Time
+	rs485    *RS485Config
+}
+
+// ReconnectPort is a Port
+var _ Port = (*ReconnectPort)(nil)
+
+// OpenReconnectPort opens the Port and keeps it open across disconnects.
+// A device that is not present yet is not an Error, the Port starts in the
+// Disconnected state and connects once the device appears.
+func OpenReconnectPort(rc *ReconnectConfig) (*ReconnectPort, error) {
+	if rc == nil {
+		return nil, fmt.Errorf("invalid configuration")
+	}
+	r := &ReconnectPort{
+		rc:    *rc,
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+		name:  rc.Name,
+	}
+	if r.rc.Backoff <= 0 {
+		r.rc.Backoff = DefaultBackoff
+	}
+	if r.rc.MaxBackoff < r.rc.Backoff {
+		r.rc.MaxBackoff = DefaultMaxBackoff
+		if r.rc.MaxBackoff < r.rc.Backoff {
+			r.rc.MaxBackoff = r.rc.Backoff
+		}
+	}
+
+	// First Attempt
+	p, name, err := r.dial()
+	if err == nil {
+		r.connected(p, name)
+		return r, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	r.notify(StateDisconnected, err)
+	go r.reconnect()
+	return r, nil
+}
+
+// State provides the current Connection state
+func (r *ReconnectPort) State() ConnState {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	switch {
+	case r.closed:
+		return StateClosed
+	case r.port != nil:
+		return StateConnected
+	}
+	return StateDisconnected
+}
+
+// dial opens the device and applies the Settings
+func (r *ReconnectPort) dial() (Port, string, error) {
+	r.mx.Lock()
+	cfg := r.rc.Config
+	rts, dtr := r.rts, r.dtr
+	rd, wd := r.rd, r.wd
+	rs485 := r.rs485
+	r.mx.Unlock()
+
+	// Find the Port by Serial Number
+	if r.rc.SerialNumber != "" {
+		name, err := findBySerial(ListPorts, r.rc.SerialNumber)
+		if err != nil {
+			return nil, "", newPortError("open", r.rc.SerialNumber, err)
+		}
+		cfg.Name = name
+	}
+
+	p, err := OpenPort(&cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Restore the RS485 mode, Signals and Deadlines
+	if rs485 != nil {
+		_, err = p.SetRS485(*rs485)
+	}
+	if err == nil && rts != nil {
+		err = p.Rts(*rts)
+	}
+	if err == nil && dtr != nil {
+		err = p.Dtr(*dtr)
+	}
+	if err == nil {
+		err = p.SetReadDeadline(rd)
+	}
+	if err == nil {
+		err = p.SetWriteDeadline(wd)
+	}
+	if err != nil {
+		p.Close()
+		return nil, "", err
+	}
+	return p, cfg.Name, nil
+}
+
+// findBySerial provides the Device of the USB Port with the Serial Number
+func findBySerial(list func() ([]PortInfo, error), serial string) (string, error) {
+	ports, err := list()
+	if err != nil {
+		return "", err
+	}
+	for _, p := range ports {
+		if p.IsUSB && p.SerialNumber == serial {
+			return p.Device, nil
+		}
+	}
+	return "", fmt.Errorf("%w - no port with serial number %q", os.ErrNotExist, serial)
+}
+
+// connected makes the Port available unless Closed in the meantime
+func (r *ReconnectPort) connected(p Port, name string) {
+	r.mx.Lock()
+	if r.closed {
+		r.mx.Unlock()
+		p.Close()
+		return
+	}
+	r.port = p
+	r.name = name
+	close(r.ready)
+	r.mx.Unlock()
+	r.notify(StateConnected, nil)
+}
+
+// reconnect tries to open the device with backoff till its Connected or
+// the Port is Closed
+func (r *ReconnectPort) reconnect() {
+	delay := r.rc.Backoff
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(delay):
+		}
+		p, name, err := r.dial()
+		if err == nil {
+			r.connected(p, name)
+			return
+		}
+		delay *= 2
+		if delay > r.rc.MaxBackoff {
+			delay = r.rc.MaxBackoff
+		}
+	}
+}
+
+// lost closes the Port after it got disconnected and starts reconnecting,
+// only the first of the parallel operations finding the Port gone does it
+func (r *ReconnectPort) lost(p Port, err error) {
+	r.mx.Lock()
+	if r.closed || r.port != p {
+		r.mx.Unlock()
+		return
+	}
+	r.port = nil
+	r.ready = make(chan struct{})
+	r.mx.Unlock()
+
+	p.Close() // Device is gone so Errors are Expected
+	r.notify(StateDisconnected, err)
+	go r.reconnect()
+}
+
+// notify reports the State change outside the Lock
+func (r *ReconnectPort) notify(state ConnState, err error) {
+	if r.rc.OnStateChange != nil {
+		r.rc.OnStateChange(state, err)
+	}
+}
+
+// current provides the Port if Connected
+func (r *ReconnectPort) current() (Port, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.closed {
+		return nil, ErrNotOpen
+	}
+	if r.port == nil {
+		return nil, ErrDisconnected
+	}
+	return r.port, nil
+}
+
+// wait provides the Port once Connected, limited by the Context and the
+// Deadline. Reads are also limited by the Read Timeout of the Config like
+// on an open Port, its expiry provides no Port and no Error.
+func (r *ReconnectPort) wait(ctx context.Context, deadline *time.Time, read bool) (p Port, err error) {
+	start := time.Now()
+	for {
+		r.mx.Lock()
+		if r.closed {
+			r.mx.Unlock()
+			return nil, ErrNotOpen
+		}
+		if r.port != nil {
+			p = r.port
+			r.mx.Unlock()
+			return p, nil
+		}
+		ready := r.ready
+		d := *deadline
+		var timeout time.Duration
+		if read {
+			timeout = r.rc.ReadTimeout
+		}
+		r.mx.Unlock()
+
+		// Read Timeout unless the Deadline is earlier
+		limit, timedOut := d, false
+		if end := start.Add(timeout); timeout > 0 && (d.IsZero() || end.Before(d)) {
+			limit, timedOut = end, true
+		}
+		var t *time.Timer
+		var expired <-chan time.Time
+		if !limit.IsZero() {
+			t = time.NewTimer(time.Until(limit))
+			expired = t.C
+		}
+		select {
+		case <-ready:
+		case <-r.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-expired:
+			if timedOut {
+				return nil, nil
+			}
+			err = os.ErrDeadlineExceeded
+		}
+		if t != nil {
+			t.Stop()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// check starts reconnecting if the operation found the Port gone
+func (r *ReconnectPort) check(p Port, err error) error {
+	if errors.Is(err, ErrNotOpen) {
+		r.mx.Lock()
+		closed := r.closed
+		r.mx.Unlock()
+		if closed {
+			return ErrNotOpen
+		}
+		// Closed by a parallel operation that found the Port gone
+		err = ErrDisconnected
+	}
+	if errors.Is(err, ErrDisconnected) || errors.Is(err, ErrCarrierLost) {
+		r.lost(p, err)
+	}
+	return err
+}
+
+// wrapError converts the Error of the Operation to PortError
+func (r *ReconnectPort) wrapError(op string, err *error) {
+	if *err == nil {
+		return
+	}
+	r.mx.Lock()
+	name := r.name
+	r.mx.Unlock()
+	*err = newPortError(op, name, *err)
+}
+
+func (r *ReconnectPort) Read(b []byte) (n int, err error) {
+	return r.ReadContext(context.Background(), b)
+}
+
+func (r *ReconnectPort) ReadContext(ctx context.Context, b []byte) (n int, err error) {
+	defer r.wrapError("read", &err)
+
+	p, err := r.wait(ctx, &r.rd, true)
+	if err != nil || p == nil {
+		return 0, err
+	}
+	n, err = p.ReadContext(ctx, b)
+	return n, r.check(p, err)
+}
+
+func (r *ReconnectPort) ReadFrame(b []byte, gap time.Duration) (n int, err error) {
+	defer r.wrapError("read frame", &err)
+
+	p, err := r.wait(context.Background(), &r.rd, true)
+	if err != nil || p == nil {
+		return 0, err
+	}
+	n, err = p.ReadFrame(b, gap)
+	return n, r.check(p, err)
+}
+
+func (r *ReconnectPort) ReadMarked(ctx context.Context, b []byte, errs []LineError) (n int, err error) {
+	defer r.wrapError("read marked", &err)
+
+	p, err := r.wait(ctx, &r.rd, true)
+	if err != nil || p == nil {
+		return 0, err
+	}
+	n, err = p.ReadMarked(ctx, b, errs)
+	return n, r.check(p, err)
+}
+
+func (r *ReconnectPort) Write(b []byte) (n int, err error) {
+	return r.WriteContext(context.Background(), b)
+}
+
+func (r *ReconnectPort) WriteContext(ctx context.Context, b []byte) (n int, err error) {
+	defer r.wrapError("write", &err)
+
+	p, err := r.wait(ctx, &r.wd, false)
+	if err != nil {
+		return 0, err
+	}
+	n, err = p.WriteContext(ctx, b)
+	return n, r.check(p, err)
+}
+
+// Close stops reconnecting and closes the Port
+func (r *ReconnectPort) Close() (err error) {
+	defer r.wrapError("close", &err)
+
+	r.mx.Lock()
+	if r.closed {
+		r.mx.Unlock()
+		return ErrPortNotInitialized
+	}
+	r.closed = true
+	close(r.done)
+	p := r.port
+	r.port = nil
+	r.mx.Unlock()
+
+	if p != nil {
+		err = p.Close()
+	}
+	r.notify(StateClosed, nil)
+	return err
+}
+
+// apply performs the setting on the Port if Connected and records it for
+// reconnection, a setting done while Disconnected is only recorded
+func (r *ReconnectPort) apply(op string, set func(p Port) error, record func()) (err error) {
+	defer r.wrapError(op, &err)
+
+	p, err := r.current()
+	if err == ErrDisconnected {
+		r.mx.Lock()
+		record()
+		r.mx.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = set(p)
+	if err != nil && !errors.Is(err, ErrDisconnected) {
+		return r.check(p, err)
+	}
+	r.mx.Lock()
+	record()
+	r.mx.Unlock()
+	return r.check(p, err)
+}
+
+func (r *ReconnectPort) SetDeadline(t time.Time) error {
+	err := r.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+	return r.SetWriteDeadline(t)
+}
+
+func (r *ReconnectPort) SetReadDeadline(t time.Time) error {
+	return r.apply("set read deadline", func(p Port) error {
+		return p.SetReadDeadline(t)
+	}, func() { r.rd = t })
+}
+
+func (r *ReconnectPort) SetWriteDeadline(t time.Time) error {
+	return r.apply("set write deadline", func(p Port) error {
+		return p.SetWriteDeadline(t)
+	}, func() { r.wd = t })
+}
+
+func (r *ReconnectPort) Rts(en bool) error {
+	return r.apply("rts", func(p Port) error {
+		return p.Rts(en)
+	}, func() { r.rts = &en })
+}
+
+func (r *ReconnectPort) Dtr(en bool) error {
+	return r.apply("dtr", func(p Port) error {
+		return p.Dtr(en)
+	}, func() { r.dtr = &en })
+}
+
+func (r *ReconnectPort) SetSignals(set, clear ModemSignal) (err error) {
+	defer r.wrapError("set signals", &err)
+
+	if err := checkSignals(set, clear); err != nil {
+		return err
+	}
+	return r.apply("set signals", func(p Port) error {
+		return p.SetSignals(set, clear)
+	}, func() { r.recordSignals(set, clear) })
+}
+
+// PulseSignals runs the sequence on the current Port, the lines as left by
+// the sequence are restored on Reconnection
+func (r *ReconnectPort) PulseSignals(ctx context.Context, steps []SignalStep) (err error) {
+	defer r.wrapError("pulse signals", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return err
+	}
+	err = p.PulseSignals(ctx, steps)
+	if err != nil {
+		return r.check(p, err)
+	}
+	r.mx.Lock()
+	for _, st := range steps {
+		r.recordSignals(st.Set, st.Clear)
+	}
+	r.mx.Unlock()
+	return nil
+}
+
+// recordSignals keeps the output lines for the Reconnection
+func (r *ReconnectPort) recordSignals(set, clear ModemSignal) {
+	for _, l := range []struct {
+		sig ModemSignal
+		en  **bool
+	}{{ModemRTS, &r.rts}, {ModemDTR, &r.dtr}} {
+		if set&l.sig != 0 {
+			en := true
+			*l.en = &en
+		} else if clear&l.sig != 0 {
+			en := false
+			*l.en = &en
+		}
+	}
+}
+
+// SetRS485 applies the RS485 mode, its applied again on Reconnection and
+// the requested settings are provided while Disconnected
+func (r *ReconnectPort) SetRS485(cfg RS485Config) (applied RS485Config, err error) {
+	applied = cfg
+	err = r.apply("set rs485", func(p Port) error {
+		var err error
+		applied, err = p.SetRS485(cfg)
+		return err
+	}, func() { r.rs485 = &cfg })
+	return applied, err
+}
+
+func (r *ReconnectPort) RS485() (cfg RS485Config, err error) {
+	defer r.wrapError("rs485", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return RS485Config{}, err
+	}
+	cfg, err = p.RS485()
+	return cfg, r.check(p, err)
+}
+
+func (r *ReconnectPort) SetBaud(baud int) error {
+	return r.apply("set baud", func(p Port) error {
+		return p.SetBaud(baud)
+	}, func() { r.rc.Baud = baud })
+}
+
+func (r *ReconnectPort) SetDataBits(bits byte) error {
+	return r.apply("set data bits", func(p Port) error {
+		return p.SetDataBits(bits)
+	}, func() { r.rc.DataBits = bits })
+}
+
+// Reconfigure applies the Configuration to the Port, the device matched
+// by its Serial Number stays in use whatever the Name
+func (r *ReconnectPort) Reconfigure(cfg Config) error {
+	return r.apply("reconfigure", func(p Port) error {
+		c := cfg
+		c.Name = ""
+		return p.Reconfigure(c)
+	}, func() {
+		cfg.Name = r.rc.Name
+		cfg.LockFile = r.rc.LockFile
+		cfg.LockDir = r.rc.LockDir
+		r.rc.Config = cfg
+	})
+}
+
+func (r *ReconnectPort) Config() (cfg Config, err error) {
+	defer r.wrapError("config", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err = p.Config()
+	return cfg, r.check(p, err)
+}
+
+func (r *ReconnectPort) SignalInvert(en bool) error {
+	return r.apply("signal invert", func(p Port) error {
+		return p.SignalInvert(en)
+	}, func() { r.rc.SignalInvert = en })
+}
+
+func (r *ReconnectPort) SendBreak(en bool) (err error) {
+	defer r.wrapError("send break", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return err
+	}
+	return r.check(p, p.SendBreak(en))
+}
+
+// WaitModemChange waits on the current Port, a Disconnection ends the wait
+func (r *ReconnectPort) WaitModemChange(ctx context.Context, mask ModemSignal) (changed ModemSignal, err error) {
+	defer r.wrapError("wait modem change", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return 0, err
+	}
+	changed, err = p.WaitModemChange(ctx, mask)
+	return changed, r.check(p, err)
+}
+
+// ModemEvents subscribes to the current Port, the channel is closed on
+// Disconnection and a new Subscription is needed after the Reconnection
+func (r *ReconnectPort) ModemEvents(ctx context.Context, mask ModemSignal) (events <-chan ModemEvent, err error) {
+	defer r.wrapError("modem events", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	events, err = p.ModemEvents(ctx, mask)
+	return events, r.check(p, err)
+}
+
+func (r *ReconnectPort) SendBreakFor(d time.Duration) (err error) {
+	defer r.wrapError("send break", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return err
+	}
+	return r.check(p, p.SendBreakFor(d))
+}
+
+func (r *ReconnectPort) Flush(in, out bool) (err error) {
+	defer r.wrapError("flush", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return err
+	}
+	return r.check(p, p.Flush(in, out))
+}
+
+func (r *ReconnectPort) Drain() error {
+	return r.DrainContext(context.Background())
+}
+
+func (r *ReconnectPort) DrainContext(ctx context.Context) (err error) {
+	defer r.wrapError("drain", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return err
+	}
+	return r.check(p, p.DrainContext(ctx))
+}
+
+func (r *ReconnectPort) InWaiting() (int, error) {
+	return r.readInt("in waiting", Port.InWaiting)
+}
+
+func (r *ReconnectPort) OutWaiting() (int, error) {
+	return r.readInt("out waiting", Port.OutWaiting)
+}
+
+// readInt performs a read back on the Port if Connected
+func (r *ReconnectPort) readInt(op string, get func(p Port) (int, error)) (n int, err error) {
+	defer r.wrapError(op, &err)
+
+	p, err := r.current()
+	if err != nil {
+		return 0, err
+	}
+	n, err = get(p)
+	return n, r.check(p, err)
+}
+
+// readBool performs a read back on the Port if Connected
+func (r *ReconnectPort) readBool(op string, get func(p Port) (bool, error)) (en bool, err error) {
+	defer r.wrapError(op, &err)
+
+	p, err := r.current()
+	if err != nil {
+		return false, err
+	}
+	en, err = get(p)
+	return en, r.check(p, err)
+}
+
+func (r *ReconnectPort) Cts() (bool, error) {
+	return r.readBool("cts", Port.Cts)
+}
+
+func (r *ReconnectPort) Dsr() (bool, error) {
+	return r.readBool("dsr", Port.Dsr)
+}
+
+func (r *ReconnectPort) Ring() (bool, error) {
+	return r.readBool("ring", Port.Ring)
+}
+
+// Counters of the current Port, they start again for a new device
+func (r *ReconnectPort) Counters() (c Counters, err error) {
+	defer r.wrapError("counters", &err)
+
+	p, err := r.current()
+	if err != nil {
+		return Counters{}, err
+	}
+	c, err = p.Counters()
+	return c, r.check(p, err)
+}
+
+func (r *ReconnectPort) Dcd() (bool, error) {
+	return r.readBool("dcd", Port.Dcd)
+}
+
+func (r *ReconnectPort) Baud() (int, error) {
+	return r.readInt("baud", Port.Baud)
+}
@@ -0,0 +1,286 @@
+// Copyright 2021 Abhijit Bose. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by a Apache 2.0 license that can be found
+// in the LICENSE file.
+
+// +build linux
+
+package serial
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Pseudo Terminal reachable through a Link that can be moved to a new
+// Pseudo Terminal to simulate the device being plugged in again
+type ptyLink struct {
+	t      *testing.T
+	dir    string
+	link   string
+	master int
+}
+
+func newPtyLink(t *testing.T) *ptyLink {
+	dir, err := ioutil.TempDir("", "serial-reconnect")
+	if err != nil {
+		t.Errorf("Error in Creating Directory - %v", err)
+		t.FailNow()
+	}
+	l := &ptyLink{t: t, dir: dir, link: filepath.Join(dir, "ttyUSB0"), master: -1}
+	l.plug()
+	return l
+}
+
+func (l *ptyLink) plug() {
+	master, slave := openPty(l.t)
+	os.Remove(l.link)
+	if err := os.Symlink(slave, l.link); err != nil {
+		unix.Close(master)
+		l.t.Errorf("Error in Creating Link - %v", err)
+		l.t.FailNow()
+	}
+	l.master = master
+}
+
+func (l *ptyLink) unplug() {
+	os.Remove(l.link)
+	unix.Close(l.master)
+	l.master = -1
+}
+
+func (l *ptyLink) cleanup() {
+	if l.master >= 0 {
+		unix.Close(l.master)
+	}
+	os.RemoveAll(l.dir)
+}
+
+// State changes Recorder
+type stateLog chan ConnState
+
+func (s stateLog) onChange(state ConnState, err error) {
+	s <- state
+}
+
+func (s stateLog) expect(t *testing.T, want ConnState) {
+	select {
+	case got := <-s:
+		if got != want {
+			t.Errorf("Expected State %v but got %v", want, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected State %v but got nothing", want)
+		t.FailNow()
+	}
+}
+
+func TestReconnectPort(t *testing.T) {
+
+	l := newPtyLink(t)
+	defer l.cleanup()
+
+	states := make(stateLog, 10)
+	r, err := OpenReconnectPort(&ReconnectConfig{
+		Config:        Config{Name: l.link, Baud: 9600},
+		Backoff:       10 * time.Millisecond,
+		MaxBackoff:    20 * time.Millisecond,
+		OnStateChange: states.onChange,
+	})
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+	defer r.Close()
+	states.expect(t, StateConnected)
+
+	// Settings changed through the Port
+	err = r.SetBaud(19200)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	c, err := r.Config()
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	c.StopBits = StopBits2
+	err = r.Reconfigure(c)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+
+	// Device Removed
+	l.unplug()
+	_, err = r.Read(make([]byte, 10))
+	if !errors.Is(err, ErrDisconnected) {
+		t.Errorf("Expected %v but got %v", ErrDisconnected, err)
+	}
+	states.expect(t, StateDisconnected)
+	if r.State() != StateDisconnected {
+		t.Errorf("Expected State %v but got %v", StateDisconnected, r.State())
+	}
+	_, err = r.Baud()
+	if !errors.Is(err, ErrDisconnected) {
+		t.Errorf("Expected %v but got %v", ErrDisconnected, err)
+	}
+
+	// Read waits for the Reconnection limited by the Context
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	_, err = r.ReadContext(ctx, make([]byte, 10))
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	// Settings while Disconnected are applied on Reconnection
+	err = r.SetDataBits(DataBits7)
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+
+	// Device Plugged in again
+	l.plug()
+	states.expect(t, StateConnected)
+
+	baud, err := r.Baud()
+	if err != nil || baud != 19200 {
+		t.Errorf("Expected Baud 19200 but got %v, %v", baud, err)
+	}
+	c, err = r.Config()
+	if err != nil || c.StopBits != StopBits2 {
+		t.Errorf("Expected 2 Stop bits but got %v, %v", &c, err)
+	}
+	r.mx.Lock()
+	bits := r.rc.DataBits
+	r.mx.Unlock()
+	if bits != DataBits7 {
+		t.Errorf("Expected Data bits %v but got %v", DataBits7, bits)
+	}
+
+	// Data flows on the new Port
+	_, err = unix.Write(l.master, []byte("Hello"))
+	if err != nil {
+		t.Errorf("Error in Writing - %v", err)
+	}
+	buf := make([]byte, 10)
+	n, err := r.Read(buf)
+	if err != nil || string(buf[:n]) != "Hello" {
+		t.Errorf("Expected %q but got %q, %v", "Hello", buf[:n], err)
+	}
+
+	// Close stops the Port
+	err = r.Close()
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+	}
+	states.expect(t, StateClosed)
+	_, err = r.Read(buf)
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+	}
+}
+
+func TestReconnectPortNotPresent(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "serial-reconnect")
+	if err != nil {
+		t.Errorf("Error in Creating Directory - %v", err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	// Missing device is not an Error
+	r, err := OpenReconnectPort(&ReconnectConfig{
+		Config:  Config{Name: filepath.Join(dir, "ttyUSB0"), Baud: 9600},
+		Backoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Errorf("Expected No Error but got %v instead", err)
+		t.FailNow()
+	}
+	if r.State() != StateDisconnected {
+		t.Errorf("Expected State %v but got %v", StateDisconnected, r.State())
+	}
+
+	// Read Timeout limits the wait like on an open Port
+	r.Reconfigure(Config{Baud: 9600, ReadTimeout: 20 * time.Millisecond})
+	start := time.Now()
+	n, err := r.Read(make([]byte, 10))
+	if n != 0 || err != nil {
+		t.Errorf("Expected no data and No Error but got %d, %v", n, err)
+	}
+	if took := time.Since(start); took < 20*time.Millisecond || took > time.Second {
+		t.Errorf("Expected the Read Timeout of 20ms but took %v", took)
+	}
+
+	// Earlier Deadline still applies
+	r.SetReadDeadline(time.Now().Add(5 * time.Millisecond))
+	_, err = r.Read(make([]byte, 10))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected %v but got %v", os.ErrDeadlineExceeded, err)
+	}
+	r.SetReadDeadline(time.Time{})
+	r.Reconfigure(Config{Baud: 9600})
+
+	// Close releases the waiting Reader
+	rDone := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, 10))
+		rDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	r.Close()
+	select {
+	case err := <-rDone:
+		if !errors.Is(err, ErrNotOpen) {
+			t.Errorf("Expected %v but got %v", ErrNotOpen, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Close did not Release the Reader")
+	}
+}
+
+func TestReconnectPortConfigError(t *testing.T) {
+	_, err := OpenReconnectPort(nil)
+	if err == nil {
+		t.Errorf("Expected Error but got NIL")
+	}
+
+	l := newPtyLink(t)
+	defer l.cleanup()
+
+	// Errors other than a missing device are Reported
+	_, err = OpenReconnectPort(&ReconnectConfig{
+		Config: Config{Name: l.link, Baud: -1},
+	})
+	if err == nil {
+		t.Errorf("Expected Error but got NIL")
+	}
+}
+
+func TestFindBySerial(t *testing.T) {
+	list := func() ([]PortInfo, error) {
+		return []PortInfo{
+			{Name: "ttyS0", Device: "/dev/ttyS0", Interface: -1},
+			{Name: "ttyUSB0", Device: "/dev/ttyUSB0", IsUSB: true, SerialNumber: "A1"},
+			{Name: "ttyUSB1", Device: "/dev/ttyUSB1", IsUSB: true, SerialNumber: "B2"},
+		}, nil
+	}
+
+	name, err := findBySerial(list, "B2")
+	if err != nil || name != "/dev/ttyUSB1" {
+		t.Errorf("Expected /dev/ttyUSB1 but got %q, %v", name, err)
+	}
+
+	_, err = findBySerial(list, "C3")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected %v but got %v", os.ErrNotExist, err)
+	}
+}
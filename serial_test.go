@@ -7,6 +7,7 @@ package serial
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -128,6 +129,22 @@ func TestSerialConfig_N04(t *testing.T) {
 	assert.Contains(t, s, "Unknown")
 }
 
+func TestSerialConfig_N06(t *testing.T) {
+	s := dataBitStr(DataBits8 + 1)
+	assert.Contains(t, s, "Unknown")
+}
+
+func TestSerialConfig_N07(t *testing.T) {
+	c := &Config{Name: "testport", Baud: 9600}
+	_, err := OpenPort(c)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	var pe *PortError
+	if assert.True(t, errors.As(err, &pe)) {
+		assert.Equal(t, "open", pe.Op)
+		assert.Contains(t, pe.Port, "testport")
+	}
+}
+
 func TestSerialConfig_N05(t *testing.T) {
 	var c *Config
 
@@ -353,6 +370,193 @@ func TestSerialConfig_P03(t *testing.T) {
 	}
 }
 
+func TestSerialConfig_P04(t *testing.T) {
+	type args struct {
+		d byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "Default Data Bits",
+			args: args{d: 0},
+			want: "8",
+		},
+		{
+			name: "5 Data Bits",
+			args: args{d: DataBits5},
+			want: "5",
+		},
+		{
+			name: "7 Data Bits",
+			args: args{d: DataBits7},
+			want: "7",
+		},
+		{
+			name: "Invalid Data Bits",
+			args: args{d: DataBits5 - 1},
+			want: "Unknown " + strconv.Itoa(int(DataBits5-1)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dataBitStr(tt.args.d); got != tt.want {
+				t.Errorf("dataBitStr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerialConfig_P05(t *testing.T) {
+	c := &Config{Name: "testport", Baud: 9600, DataBits: DataBits7, Parity: ParityEven}
+	assert.Contains(t, c.String(), "DataBits: 7 bits")
+}
+
+func TestSerialConfig_P06(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want time.Duration
+	}{
+		{
+			name: "Invalid Baud",
+			cfg:  Config{},
+			want: 0,
+		},
+		{
+			name: "8N1 at 9600",
+			cfg:  Config{Baud: 9600},
+			want: 10 * time.Second / 9600,
+		},
+		{
+			name: "7E1 at 9600",
+			cfg:  Config{Baud: 9600, DataBits: DataBits7, Parity: ParityEven},
+			want: 10 * time.Second / 9600,
+		},
+		{
+			name: "8E2 at 19200",
+			cfg:  Config{Baud: 19200, Parity: ParityEven, StopBits: StopBits2},
+			want: 12 * time.Second / 19200,
+		},
+		{
+			name: "5N1.5 at 50",
+			cfg:  Config{Baud: 50, DataBits: DataBits5, StopBits: StopBits15},
+			want: 150 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.CharTime(); got != tt.want {
+				t.Errorf("CharTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerialConfig_P07(t *testing.T) {
+	err := newPortError("read", "/dev/ttyUSB0", ErrNotOpen)
+	assert.Equal(t, "read /dev/ttyUSB0: port not open", err.Error())
+	assert.True(t, errors.Is(err, ErrNotOpen))
+	assert.False(t, errors.Is(err, ErrBusy))
+
+	// Already wrapped Errors are kept
+	assert.Equal(t, err, newPortError("write", "/dev/ttyUSB1", err))
+	wrapped := fmt.Errorf("context - %w", err)
+	assert.Equal(t, wrapped, newPortError("write", "/dev/ttyUSB1", wrapped))
+
+	// Errors of the Context are provided as is
+	assert.Equal(t, context.Canceled, newPortError("read", "", context.Canceled))
+	assert.Equal(t, context.DeadlineExceeded, newPortError("read", "", context.DeadlineExceeded))
+	assert.Nil(t, newPortError("read", "", nil))
+
+	// Without the Port
+	err = newPortError("open", "", ErrAccessDenied)
+	assert.Equal(t, "open: access denied", err.Error())
+}
+
+func TestSerialConfig_P08(t *testing.T) {
+	prev := Counters{Rx: 0xFFFFFFF0, Tx: 100, Frame: 2, Parity: 1}
+	cur := Counters{Rx: 0x10, Tx: 150, Frame: 5, Parity: 1, Overrun: 1, DCD: 2}
+
+	// Change is correct across the wrap around
+	d := cur.Sub(prev)
+	assert.Equal(t, Counters{Rx: 0x20, Tx: 50, Frame: 3, Overrun: 1, DCD: 2}, d)
+	assert.Equal(t, uint32(4), d.Errors())
+	assert.Equal(t, Counters{}, cur.Sub(cur))
+}
+
+func TestSerialConfig_P09(t *testing.T) {
+	c := &Config{Baud: 9600, DataBits: DataBits8, StopBits: StopBits1}
+
+	// Break is longer than a Character
+	min := c.CharTime() + time.Second/9600
+	assert.Equal(t, min, c.BreakTime(0))
+	assert.Equal(t, min, c.BreakTime(100*time.Microsecond))
+	assert.Equal(t, 10*time.Millisecond, c.BreakTime(10*time.Millisecond))
+
+	// Without the Baud rate the duration is kept
+	c.Baud = 0
+	assert.Equal(t, time.Millisecond, c.BreakTime(time.Millisecond))
+}
+
+// Recorder of the output line changes
+type signalLog struct {
+	set, clear []ModemSignal
+	at         []time.Time
+}
+
+func (l *signalLog) apply(set, clear ModemSignal) error {
+	l.set = append(l.set, set)
+	l.clear = append(l.clear, clear)
+	l.at = append(l.at, time.Now())
+	return nil
+}
+
+func TestSerialConfig_P10(t *testing.T) {
+	assert.Nil(t, checkSignals(ModemRTS, ModemDTR))
+	assert.Nil(t, checkSignals(0, ModemOutputs))
+	assert.NotNil(t, checkSignals(ModemCTS, 0))
+	assert.NotNil(t, checkSignals(ModemRTS, ModemRTS))
+	assert.Equal(t, "RTS|DTR", ModemOutputs.String())
+
+	// Lines are held for each Step
+	l := &signalLog{}
+	start := time.Now()
+	err := pulseSignals(context.Background(), ResetESP32, l.apply)
+	assert.Nil(t, err)
+	assert.Equal(t, []ModemSignal{ModemRTS, ModemDTR, 0}, l.set)
+	assert.Equal(t, []ModemSignal{ModemDTR, ModemRTS, ModemDTR}, l.clear)
+	holds := []time.Duration{100 * time.Millisecond, 50 * time.Millisecond}
+	prev := start
+	for i, hold := range holds {
+		took := l.at[i+1].Sub(l.at[i])
+		if took < hold || took > hold+20*time.Millisecond {
+			t.Errorf("Step %d Expected %v but held %v", i, hold, took)
+		}
+		prev = l.at[i+1]
+	}
+	assert.True(t, prev.Sub(start) >= 150*time.Millisecond)
+
+	// Context stops the Sequence
+	l = &signalLog{}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	err = pulseSignals(ctx, ResetArduino, l.apply)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, len(l.set))
+
+	// Invalid Steps are found before any change
+	l = &signalLog{}
+	err = pulseSignals(context.Background(), []SignalStep{
+		{Set: ModemDTR, Hold: time.Millisecond},
+		{Set: ModemDSR},
+	}, l.apply)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(l.set))
+}
+
 func TestSerialIntegration_P01(t *testing.T) {
 
 	verifySetup(t, paramLOOPBACK)
@@ -895,7 +1099,10 @@ func TestBaudrates(t *testing.T) {
 		{3000000, 1024, false, 1200 * time.Millisecond},
 		{3500000, 1024, false, 1200 * time.Millisecond},
 		{4000000, 1024, false, 1200 * time.Millisecond},
-		{4500000, 1024, true, 0},
+		{31250, 100, false, 2000 * time.Millisecond},
+		{74880, 1024, false, 1500 * time.Millisecond},
+		{250000, 1024, false, 1200 * time.Millisecond},
+		{-1, 0, true, 0},
 	}
 
 	// Run Through the Test
@@ -9,11 +9,14 @@ package serial
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
 	"os"
 	"sync"
 	"syscall"
+	"time"
+
+	"github.com/boseji/serial/internal/timing"
 )
 
 // TODO: Add Custom Logging for each instance
@@ -30,6 +33,10 @@ type serialPort struct {
 
 	rl sync.Mutex // Need to Eleminate these
 	wl sync.Mutex
+
+	dl sync.Mutex // Lock for the Deadlines
+	rd time.Time  // Read Deadline
+	wd time.Time  // Write Deadline
 }
 
 /**
@@ -37,7 +44,8 @@ Library Access
 */
 
 // Platform Specific Open Port Function
-func openPort(cfg *Config) (Port, error) {
+func openPort(cfg *Config) (port Port, err error) {
+	defer func() { err = newPortError("open", cfg.Name, err) }()
 
 	if len(cfg.Name) > 0 && cfg.Name[0] != '\\' {
 		cfg.Name = "\\\\.\\" + cfg.Name
@@ -45,7 +53,7 @@ func openPort(cfg *Config) (Port, error) {
 
 	name, err := syscall.UTF16PtrFromString(cfg.Name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to to prepare name of 'COM' port while opening - %w", err)
+		return nil, err
 	}
 	// Create the Handle
 	h, err := syscall.CreateFile(name,
@@ -68,7 +76,7 @@ func openPort(cfg *Config) (Port, error) {
 		}
 	}()
 
-	if err = wSetCommState(h, cfg.Baud, cfg.StopBits, cfg.Parity, cfg.Flow); err != nil {
+	if err = wSetCommState(h, cfg.Baud, cfg.DataBits, cfg.StopBits, cfg.Parity, cfg.Flow); err != nil {
 		return nil, err
 	}
 
@@ -103,11 +111,53 @@ func openPort(cfg *Config) (Port, error) {
 	return sp, nil
 }
 
+// wrapError converts the Error of the Operation to PortError
+func (p *serialPort) wrapError(op string, err *error) {
+	if *err == nil {
+		return
+	}
+	name := ""
+	if p != nil {
+		name = p.conf.Name
+	}
+	*err = newPortError(op, name, *err)
+}
+
+// mapErrno provides the Error matching the System Error for PortError
+func mapErrno(err error) error {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return nil
+	}
+	switch errno {
+	case errorSharingViolation:
+		return ErrBusy
+	case syscall.ERROR_ACCESS_DENIED:
+		return ErrAccessDenied
+	case errorBadCommand, errorGenFailure, errorDeviceNotConnected, errorDeviceRemoved:
+		return ErrDisconnected
+	case errorInvalidHandle:
+		return ErrNotOpen
+	}
+	return nil
+}
+
+// Platform Specific Port Enumeration Function
+func listPorts() ([]PortInfo, error) {
+	return nil, ErrNotImplemented
+}
+
+// Platform Specific Port Watch Function
+func watchPorts(ctx context.Context) (<-chan PortEvent, error) {
+	return nil, ErrNotImplemented
+}
+
 /**
 Interface Functions
 */
 
-func (p *serialPort) Close() error {
+func (p *serialPort) Close() (err error) {
+	defer p.wrapError("close", &err)
 
 	if p == nil || p.fileInstance == nil {
 		return ErrPortNotInitialized
@@ -118,10 +168,10 @@ func (p *serialPort) Close() error {
 }
 
 func (p *serialPort) Write(buf []byte) (int, error) {
+	return p.WriteContext(context.Background(), buf)
+}
 
-	if p == nil || p.fileInstance == nil {
-		return 0, ErrPortNotInitialized
-	}
+func (p *serialPort) write(buf []byte) (int, error) {
 
 	p.wl.Lock()
 	defer p.wl.Unlock()
@@ -138,10 +188,10 @@ func (p *serialPort) Write(buf []byte) (int, error) {
 }
 
 func (p *serialPort) Read(buf []byte) (int, error) {
+	return p.ReadContext(context.Background(), buf)
+}
 
-	if p == nil || p.fileInstance == nil {
-		return 0, ErrPortNotInitialized
-	}
+func (p *serialPort) read(buf []byte) (int, error) {
 
 	p.rl.Lock()
 	defer p.rl.Unlock()
@@ -157,7 +207,165 @@ func (p *serialPort) Read(buf []byte) (int, error) {
 	return wGetOverlappedResult(p.hWnd, p.ro)
 }
 
-func (p *serialPort) Rts(en bool) error {
+func (p *serialPort) ReadContext(ctx context.Context, buf []byte) (n int, err error) {
+	defer p.wrapError("read", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return 0, ErrPortNotInitialized
+	}
+
+	p.dl.Lock()
+	deadline := p.rd
+	p.dl.Unlock()
+
+	return p.ioDeadline(ctx, deadline, p.ro, func() (int, error) {
+		return p.read(buf)
+	})
+}
+
+func (p *serialPort) WriteContext(ctx context.Context, buf []byte) (n int, err error) {
+	defer p.wrapError("write", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return 0, ErrPortNotInitialized
+	}
+
+	p.dl.Lock()
+	deadline := p.wd
+	p.dl.Unlock()
+
+	return p.ioDeadline(ctx, deadline, p.wo, func() (int, error) {
+		return p.write(buf)
+	})
+}
+
+func (p *serialPort) ReadFrame(buf []byte, gap time.Duration) (n int, err error) {
+	defer p.wrapError("read frame", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return 0, ErrPortNotInitialized
+	}
+
+	if gap <= 0 {
+		gap = p.conf.CharTime() * 7 / 2
+	}
+
+	// Wait for the Start of the Frame
+	n, err = p.Read(buf)
+
+	// Collect till the Line is idle for the gap
+	for err == nil && n > 0 && n < len(buf) {
+		var m int
+		m, err = p.ioDeadline(context.Background(), time.Now().Add(gap), p.ro, func() (int, error) {
+			return p.read(buf[n:])
+		})
+		if err == os.ErrDeadlineExceeded {
+			err = nil
+		}
+		if m == 0 {
+			break
+		}
+		n += m
+	}
+	return n, err
+}
+
+func (p *serialPort) SetDeadline(t time.Time) (err error) {
+	defer p.wrapError("set deadline", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	p.dl.Lock()
+	p.rd = t
+	p.wd = t
+	p.dl.Unlock()
+	return nil
+}
+
+func (p *serialPort) SetReadDeadline(t time.Time) (err error) {
+	defer p.wrapError("set read deadline", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	p.dl.Lock()
+	p.rd = t
+	p.dl.Unlock()
+	return nil
+}
+
+func (p *serialPort) SetWriteDeadline(t time.Time) (err error) {
+	defer p.wrapError("set write deadline", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	p.dl.Lock()
+	p.wd = t
+	p.dl.Unlock()
+	return nil
+}
+
+// ioDeadline runs the Overlapped operation till the deadline of the Port
+func (p *serialPort) ioDeadline(ctx context.Context, deadline time.Time, o *syscall.Overlapped, op func() (int, error)) (int, error) {
+
+	if deadline.IsZero() {
+		return p.ioContext(ctx, o, op)
+	}
+
+	dctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	n, err := p.ioContext(dctx, o, op)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		err = os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+// ioContext runs the Overlapped operation and cancels it when the Context is done
+func (p *serialPort) ioContext(ctx context.Context, o *syscall.Overlapped, op func() (int, error)) (int, error) {
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		exited := make(chan struct{})
+		go func() {
+			defer close(exited)
+			select {
+			case <-done:
+				wCancelIoEx(p.hWnd, o)
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-exited
+		}()
+	}
+
+	n, err := op()
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if wIsHangup(err) {
+		// Device is gone so Errors are Expected
+		p.cancelfunc()
+		p.fileInstance.Close()
+		err = ErrDisconnected
+	}
+	return n, err
+}
+
+func (p *serialPort) Rts(en bool) (err error) {
+	defer p.wrapError("rts", &err)
 
 	if p == nil || p.fileInstance == nil {
 		return ErrPortNotInitialized
@@ -177,7 +385,8 @@ func (p *serialPort) Rts(en bool) error {
 	return wEscapeCommFunction(p.hWnd, val)
 }
 
-func (p *serialPort) Cts() (bool, error) {
+func (p *serialPort) Cts() (en bool, err error) {
+	defer p.wrapError("cts", &err)
 
 	if p == nil || p.fileInstance == nil {
 		return false, ErrPortNotInitialized
@@ -195,7 +404,8 @@ func (p *serialPort) Cts() (bool, error) {
 	return ret, nil
 }
 
-func (p *serialPort) Dtr(en bool) error {
+func (p *serialPort) Dtr(en bool) (err error) {
+	defer p.wrapError("dtr", &err)
 
 	if p == nil || p.fileInstance == nil {
 		return ErrPortNotInitialized
@@ -215,7 +425,8 @@ func (p *serialPort) Dtr(en bool) error {
 	return wEscapeCommFunction(p.hWnd, val)
 }
 
-func (p *serialPort) Dsr() (bool, error) {
+func (p *serialPort) Dsr() (en bool, err error) {
+	defer p.wrapError("dsr", &err)
 
 	if p == nil || p.fileInstance == nil {
 		return false, ErrPortNotInitialized
@@ -234,7 +445,9 @@ func (p *serialPort) Dsr() (bool, error) {
 	return ret, nil
 }
 
-func (p *serialPort) Ring() (bool, error) {
+func (p *serialPort) Ring() (en bool, err error) {
+	defer p.wrapError("ring", &err)
+
 	if p == nil || p.fileInstance == nil {
 		return false, ErrPortNotInitialized
 	}
@@ -252,13 +465,34 @@ func (p *serialPort) Ring() (bool, error) {
 	return ret, nil
 }
 
-func (p *serialPort) SetBaud(baud int) error {
+func (p *serialPort) Dcd() (en bool, err error) {
+	defer p.wrapError("dcd", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return false, ErrPortNotInitialized
+	}
+
+	status, err := wGetCommModemStatus(p.hWnd)
+	if err != nil {
+		return false, err
+	}
+
+	ret := ((status & modemStatusMask_RLSD_ON) != 0)
+	if p.conf.SignalInvert {
+		ret = !ret
+	}
+
+	return ret, nil
+}
+
+func (p *serialPort) SetBaud(baud int) (err error) {
+	defer p.wrapError("set baud", &err)
 
 	if p == nil || p.fileInstance == nil {
 		return ErrPortNotInitialized
 	}
 
-	if err := wSetCommState(p.hWnd, baud, p.conf.StopBits, p.conf.Parity, p.conf.Flow); err != nil {
+	if err := wSetCommState(p.hWnd, baud, p.conf.DataBits, p.conf.StopBits, p.conf.Parity, p.conf.Flow); err != nil {
 		return err
 	}
 
@@ -266,7 +500,152 @@ func (p *serialPort) SetBaud(baud int) error {
 	return nil
 }
 
-func (p *serialPort) SignalInvert(en bool) error {
+func (p *serialPort) Baud() (baud int, err error) {
+	defer p.wrapError("baud", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return 0, ErrPortNotInitialized
+	}
+
+	return wGetCommBaud(p.hWnd)
+}
+
+func (p *serialPort) SetDataBits(bits byte) (err error) {
+	defer p.wrapError("set data bits", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	if err := wSetCommState(p.hWnd, p.conf.Baud, bits, p.conf.StopBits, p.conf.Parity, p.conf.Flow); err != nil {
+		return err
+	}
+
+	p.conf.DataBits = bits
+	return nil
+}
+
+func (p *serialPort) Reconfigure(cfg Config) (err error) {
+	defer p.wrapError("reconfigure", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	if err := wSetCommState(p.hWnd, cfg.Baud, cfg.DataBits, cfg.StopBits, cfg.Parity, cfg.Flow); err != nil {
+		return err
+	}
+
+	cfg.Name = p.conf.Name
+	p.conf = cfg
+	return nil
+}
+
+func (p *serialPort) Config() (cfg Config, err error) {
+	defer p.wrapError("config", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return Config{}, ErrPortNotInitialized
+	}
+
+	cfg = p.conf
+	if err := wGetCommConfig(p.hWnd, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (p *serialPort) Flush(in, out bool) (err error) {
+	defer p.wrapError("flush", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	var flags uint32
+	if in {
+		flags |= purgeRxClear
+	}
+	if out {
+		flags |= purgeTxClear
+	}
+	if flags == 0 {
+		return nil
+	}
+	return wPurgeComm(p.hWnd, flags)
+}
+
+func (p *serialPort) Drain() error {
+	return p.DrainContext(context.Background())
+}
+
+func (p *serialPort) DrainContext(ctx context.Context) (err error) {
+	defer p.wrapError("drain", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	return p.drain(ctx)
+}
+
+// drain waits for the Output to be sent
+func (p *serialPort) drain(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Wait for the Output queue to empty, checking the Context
+	charTime := p.conf.CharTime()
+	for {
+		_, n, err := wGetCommQueues(p.hWnd)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		wait := charTime * time.Duration(n)
+		if wait < time.Millisecond {
+			wait = time.Millisecond
+		} else if wait > 50*time.Millisecond {
+			wait = 50 * time.Millisecond
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return syscall.FlushFileBuffers(p.hWnd)
+}
+
+func (p *serialPort) InWaiting() (n int, err error) {
+	defer p.wrapError("in waiting", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return 0, ErrPortNotInitialized
+	}
+
+	n, _, err = wGetCommQueues(p.hWnd)
+	return n, err
+}
+
+func (p *serialPort) OutWaiting() (n int, err error) {
+	defer p.wrapError("out waiting", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return 0, ErrPortNotInitialized
+	}
+
+	_, n, err = wGetCommQueues(p.hWnd)
+	return n, err
+}
+
+func (p *serialPort) SignalInvert(en bool) (err error) {
+	defer p.wrapError("signal invert", &err)
 
 	if p == nil || p.fileInstance == nil {
 		return ErrPortNotInitialized
@@ -276,7 +655,8 @@ func (p *serialPort) SignalInvert(en bool) error {
 	return nil
 }
 
-func (p *serialPort) SendBreak(en bool) error {
+func (p *serialPort) SendBreak(en bool) (err error) {
+	defer p.wrapError("send break", &err)
 
 	if p == nil || p.fileInstance == nil {
 		return ErrPortNotInitialized
@@ -289,3 +669,103 @@ func (p *serialPort) SendBreak(en bool) error {
 
 	return wEscapeCommFunction(p.hWnd, val)
 }
+
+func (p *serialPort) WaitModemChange(ctx context.Context, mask ModemSignal) (changed ModemSignal, err error) {
+	defer p.wrapError("wait modem change", &err)
+	return 0, ErrNotImplemented
+}
+
+func (p *serialPort) ModemEvents(ctx context.Context, mask ModemSignal) (events <-chan ModemEvent, err error) {
+	defer p.wrapError("modem events", &err)
+	return nil, ErrNotImplemented
+}
+
+func (p *serialPort) Counters() (c Counters, err error) {
+	defer p.wrapError("counters", &err)
+	return Counters{}, ErrNotImplemented
+}
+
+func (p *serialPort) ReadMarked(ctx context.Context, buf []byte, errs []LineError) (n int, err error) {
+	defer p.wrapError("read marked", &err)
+	return 0, ErrNotImplemented
+}
+
+func (p *serialPort) SendBreakFor(d time.Duration) (err error) {
+	defer p.wrapError("send break", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	// Break follows the pending data
+	err = p.drain(context.Background())
+	if err != nil {
+		return err
+	}
+
+	err = wEscapeCommFunction(p.hWnd, ECF_SetBreak)
+	if err != nil {
+		return err
+	}
+	timing.SleepFor(p.conf.BreakTime(d))
+	return wEscapeCommFunction(p.hWnd, ECF_ClrBreak)
+}
+
+func (p *serialPort) SetSignals(set, clear ModemSignal) (err error) {
+	defer p.wrapError("set signals", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	if err := checkSignals(set, clear); err != nil {
+		return err
+	}
+	return p.setSignals(set, clear)
+}
+
+func (p *serialPort) PulseSignals(ctx context.Context, steps []SignalStep) (err error) {
+	defer p.wrapError("pulse signals", &err)
+
+	if p == nil || p.fileInstance == nil {
+		return ErrPortNotInitialized
+	}
+
+	return pulseSignals(ctx, steps, p.setSignals)
+}
+
+// setSignals activates and deactivates the output lines one at a time
+func (p *serialPort) setSignals(set, clear ModemSignal) error {
+	if p.conf.SignalInvert {
+		set, clear = clear, set
+	}
+
+	for _, l := range []struct {
+		sig      ModemSignal
+		set, clr uint32
+	}{
+		{ModemRTS, ECF_SetRts, ECF_ClrRts},
+		{ModemDTR, ECF_SetDtr, ECF_ClrDtr},
+	} {
+		var err error
+		if set&l.sig != 0 {
+			err = wEscapeCommFunction(p.hWnd, l.set)
+		} else if clear&l.sig != 0 {
+			err = wEscapeCommFunction(p.hWnd, l.clr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *serialPort) SetRS485(cfg RS485Config) (applied RS485Config, err error) {
+	defer p.wrapError("set rs485", &err)
+	return RS485Config{}, ErrNotImplemented
+}
+
+func (p *serialPort) RS485() (cfg RS485Config, err error) {
+	defer p.wrapError("rs485", &err)
+	return RS485Config{}, ErrNotImplemented
+}